@@ -1,8 +1,12 @@
 package application
 
 import (
+	"context"
+	"errors"
+	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 )
 
@@ -18,6 +22,9 @@ func (t tasks) invoke() {
 	}
 }
 
+// returned by Reload() once the application is stopping
+var ErrStopping = errors.New("application is stopping")
+
 type App interface {
 	Run()
 	Defer(tasks ...func()) App
@@ -26,11 +33,51 @@ type App interface {
 	Stop()
 }
 
+// Application extends App with components, reload hooks and lifecycle channels.
+type Application interface {
+	// Run() starts registered components, then blocks until the application is stopped.
+	// stop tasks are invoked after all components have been stopped and forced stop cancels context
+	// of the stopping components.
+	App
+	// returns errors of the components' start and stop, if any, once Run() has returned
+	Err() error
+	// components are started in order of their dependencies when the application runs,
+	// independent components are started in parallel, and stopped in the reverse order.
+	Register(name string, c Component, opts ComponentOptions) Application
+	// reload hooks are invoked on SIGHUP or Reload(), followed by reloading of the started components
+	// which implement the Reloader interface. reload never runs concurrently with stopping.
+	OnReload(hooks ...func() error) Application
+	// receives errors of the reload triggered by SIGHUP, by default they are logged
+	OnReloadError(handler func(err error)) Application
+	// invokes reload hooks and returns their errors
+	Reload() error
+	// closed once all components have started, it is never closed if any of them failed
+	Ready() <-chan struct{}
+	// closed once the application starts stopping, before any component or stop task is stopped
+	Stopping() <-chan struct{}
+}
+
 func New() App {
-	return new(instance)
+	return newInstance()
+}
+
+func NewApplication() Application {
+	return newInstance()
+}
+
+func newInstance() *instance {
+	return &instance{
+		sigChan:  make(chan os.Signal, 1),
+		doneChan: make(chan struct{}, 1),
+		stopChan: make(chan struct{}, 1),
+		started:  make(chan struct{}),
+		ready:    make(chan struct{}),
+		stopping: make(chan struct{}),
+	}
 }
 
 type instance struct {
+	mx              sync.Mutex
 	sigChan         chan os.Signal
 	doneChan        chan struct{}
 	stopChan        chan struct{}
@@ -39,6 +86,20 @@ type instance struct {
 	deferred        tasks
 	stopTasks       tasks
 	forcedStopTasks tasks
+	reloadHooks     []func() error
+	reloadError     func(err error)
+	components      components
+	// serialises reload with stopping of the application
+	lifecycle sync.Mutex
+	// cancels starting of the components
+	cancelStart context.CancelFunc
+	// closed once the components have started or failed to start
+	started chan struct{}
+	// cancels stopping of the components on forced stop
+	cancelStop context.CancelFunc
+	ready      chan struct{}
+	stopping   chan struct{}
+	errs       Errors
 }
 
 func (app *instance) Defer(tasks ...func()) App {
@@ -56,6 +117,79 @@ func (app *instance) OnForcedStop(tasks ...func()) App {
 	return app
 }
 
+func (app *instance) Register(name string, c Component, opts ComponentOptions) Application {
+	app.components.add(name, c, opts)
+	return app
+}
+
+func (app *instance) OnReload(hooks ...func() error) Application {
+	app.mx.Lock()
+	app.reloadHooks = append(app.reloadHooks, hooks...)
+	app.mx.Unlock()
+	return app
+}
+
+func (app *instance) OnReloadError(handler func(err error)) Application {
+	app.mx.Lock()
+	app.reloadError = handler
+	app.mx.Unlock()
+	return app
+}
+
+func (app *instance) Reload() error {
+	app.lifecycle.Lock()
+	defer app.lifecycle.Unlock()
+
+	app.mx.Lock()
+	stopping := app.closing || app.forced
+	hooks := app.reloadHooks
+	app.mx.Unlock()
+	if stopping {
+		return ErrStopping
+	}
+
+	var errs Errors
+	for _, hook := range hooks {
+		if hook != nil {
+			if err := hook(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	errs = append(errs, app.components.reload(context.Background())...)
+	return errs.err()
+}
+
+func (app *instance) reload() {
+	err := app.Reload()
+	if err == nil || err == ErrStopping {
+		return
+	}
+
+	app.mx.Lock()
+	handler := app.reloadError
+	app.mx.Unlock()
+	if handler != nil {
+		handler(err)
+	} else {
+		log.Println("failed to reload application: ", err)
+	}
+}
+
+func (app *instance) Err() error {
+	app.mx.Lock()
+	defer app.mx.Unlock()
+	return app.errs.err()
+}
+
+func (app *instance) Ready() <-chan struct{} {
+	return app.ready
+}
+
+func (app *instance) Stopping() <-chan struct{} {
+	return app.stopping
+}
+
 func (app *instance) Stop() {
 	app.stopChan <- struct{}{}
 }
@@ -67,27 +201,75 @@ func (app *instance) done() {
 	}
 }
 
+func (app *instance) fail(err error) {
+	if err != nil {
+		app.mx.Lock()
+		app.errs = append(app.errs, err)
+		app.mx.Unlock()
+	}
+}
+
 func (app *instance) shutdown(force bool) {
-	defer app.done()
+	app.stop(force, false)
+}
+
+// failed start stops the application only if it is not already stopping
+func (app *instance) stop(force bool, failure bool) {
+	app.mx.Lock()
+	if failure && (app.closing || app.forced) {
+		app.mx.Unlock()
+		return
+	}
 
+	// stopping the forced stop ends the application even if the forced stop tasks are blocked
 	if app.forced {
+		app.mx.Unlock()
+		app.done()
 		return
 	}
 
+	if app.closing == false {
+		close(app.stopping)
+	}
+
 	if app.closing || force {
 		app.forced = true
+		cancelStop := app.cancelStop
+		app.mx.Unlock()
+		defer app.done()
+		app.cancelStart()
+		cancelStop()
 		app.forcedStopTasks.invoke()
 		return
 	}
 
 	app.closing = true
+	app.mx.Unlock()
+	defer app.done()
+
+	app.cancelStart()
+	<-app.started
+
+	// waits for the running reload to finish
+	app.lifecycle.Lock()
+	defer app.lifecycle.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.mx.Lock()
+	app.cancelStop = cancel
+	forced := app.forced
+	app.mx.Unlock()
+	if forced {
+		cancel()
+	}
+
+	app.fail(app.components.stop(ctx))
+	cancel()
 	app.stopTasks.invoke()
 }
 
 func (app *instance) Run() {
-	app.sigChan = make(chan os.Signal, 1)
-	app.doneChan = make(chan struct{}, 1)
-	app.stopChan = make(chan struct{}, 1)
+	app.cancelStop = func() {}
 	defer app.deferred.invoke()
 
 	// Info on signals: https://www.gnu.org/software/libc/manual/html_node/Termination-Signals.html
@@ -96,16 +278,49 @@ func (app *instance) Run() {
 		syscall.SIGTERM,
 		syscall.SIGINT,
 		syscall.SIGQUIT,
-		syscall.SIGKILL,
+		syscall.SIGHUP,
 	)
+	defer signal.Stop(app.sigChan)
+
+	var ctx context.Context
+	ctx, app.cancelStart = context.WithCancel(context.Background())
+	defer app.cancelStart()
+
+	startErr := make(chan error, 1)
+	go func() {
+		err := app.components.start(ctx)
+		// the start has been cancelled by stopping the application so it did not actually fail
+		if ctx.Err() != nil {
+			err = nil
+		}
+		if err == nil && ctx.Err() == nil {
+			close(app.ready)
+		}
+		startErr <- err
+		close(app.started)
+	}()
 
 	for {
 		select {
+		case err := <-startErr:
+			// the components which have started are stopped along with the application
+			if err != nil {
+				app.fail(err)
+				go app.stop(false, true)
+			}
+
 		case s := <-app.sigChan:
-			go app.shutdown(s == syscall.SIGKILL)
+			if s == syscall.SIGHUP {
+				go app.reload()
+			} else {
+				go app.shutdown(false)
+			}
 
 		case <-app.stopChan:
-			go app.shutdown(app.forced)
+			app.mx.Lock()
+			forced := app.forced
+			app.mx.Unlock()
+			go app.shutdown(forced)
 
 		case <-app.doneChan:
 			return
@@ -49,6 +49,37 @@ func TestStop(t *testing.T) {
 	}
 }
 
+func TestStopping(t *testing.T) {
+	app := NewApplication()
+
+	select {
+	case <-app.Stopping():
+		t.Fatal("Unexpected stopping signal before stop.")
+	default:
+	}
+
+	// stopping is signalled before the stop functions are invoked
+	var signalled bool
+	app.OnStop(func() {
+		select {
+		case <-app.Stopping():
+			signalled = true
+		default:
+		}
+	})
+
+	go func() {
+		time.Sleep(time.Second)
+		app.Stop()
+	}()
+
+	app.Run()
+
+	if signalled == false {
+		t.Error("Failed to signal stopping before stop functions.")
+	}
+}
+
 func TestForcedStop(t *testing.T) {
 	app := New()
 
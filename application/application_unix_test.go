@@ -3,15 +3,17 @@
 
 package application
 
-import "testing"
+import (
+	"syscall"
+	"testing"
+	"time"
+)
 
 func TestSignalStop(t *testing.T) {
-	signals := []os.Signal{
+	signals := []syscall.Signal{
 		syscall.SIGTERM,
 		syscall.SIGINT,
-		syscall.SIGHUP,
 		syscall.SIGQUIT,
-		syscall.SIGKILL,
 	}
 
 	for _, sig := range signals {
@@ -24,10 +26,10 @@ func TestSignalStop(t *testing.T) {
 		var stop bool
 		app.OnStop(func() { stop = true })
 
-		go func() {
+		go func(sig syscall.Signal) {
 			time.Sleep(time.Second)
 			syscall.Kill(syscall.Getpid(), sig)
-		}()
+		}(sig)
 
 		app.Run()
 
@@ -40,3 +42,29 @@ func TestSignalStop(t *testing.T) {
 		}
 	}
 }
+
+func TestSignalReload(t *testing.T) {
+	app := NewApplication()
+
+	reloaded := make(chan struct{})
+	app.OnReload(func() error {
+		close(reloaded)
+		return nil
+	})
+
+	var stop bool
+	app.OnStop(func() { stop = true })
+
+	go func() {
+		time.Sleep(time.Second)
+		syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+		<-reloaded
+		app.Stop()
+	}()
+
+	app.Run()
+
+	if stop == false {
+		t.Error("Failed to invoke stop functions.")
+	}
+}
@@ -0,0 +1,266 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Component is a long-running part of the application, ie. database connection or server,
+// which is started before the application runs and stopped when it stops.
+type Component interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Reloader is optionally implemented by a component which can reload its configuration, ie. reopen its files
+type Reloader interface {
+	Reload(ctx context.Context) error
+}
+
+// allows using plain functions as a component
+type ComponentFuncs struct {
+	StartFunc func(ctx context.Context) error
+	StopFunc  func(ctx context.Context) error
+}
+
+func (c ComponentFuncs) Start(ctx context.Context) error {
+	if c.StartFunc == nil {
+		return nil
+	}
+	return c.StartFunc(ctx)
+}
+
+func (c ComponentFuncs) Stop(ctx context.Context) error {
+	if c.StopFunc == nil {
+		return nil
+	}
+	return c.StopFunc(ctx)
+}
+
+type ComponentOptions struct {
+	// names of the components which have to be started before this one and stopped after it
+	DependsOn []string
+	// zero means no timeout
+	StartTimeout time.Duration
+	// zero means no timeout
+	StopTimeout time.Duration
+}
+
+// Errors aggregates multiple errors into one
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// returns nil if there are no errors, the error itself if there is only one, or the Errors otherwise
+func (e Errors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	default:
+		return e
+	}
+}
+
+// ComponentError wraps an error returned by a component
+type ComponentError struct {
+	Name string
+	// "start", "stop" or "reload"
+	Op  string
+	Err error
+}
+
+func (e *ComponentError) Error() string {
+	return fmt.Sprintf("component %s failed to %s: %v", e.Name, e.Op, e.Err)
+}
+
+func (e *ComponentError) Unwrap() error {
+	return e.Err
+}
+
+type component struct {
+	name    string
+	c       Component
+	opts    ComponentOptions
+	started bool
+}
+
+type components struct {
+	mx   sync.Mutex
+	list []*component
+	// components grouped so that each group depends only on the previous ones
+	levels [][]*component
+}
+
+func (cs *components) add(name string, c Component, opts ComponentOptions) {
+	cs.mx.Lock()
+	cs.list = append(cs.list, &component{name: name, c: c, opts: opts})
+	cs.mx.Unlock()
+}
+
+// orders components by their dependencies, components on the same level are independent of each other
+func (cs *components) resolve() error {
+	byName := make(map[string]*component, len(cs.list))
+	for _, c := range cs.list {
+		if _, ok := byName[c.name]; ok {
+			return fmt.Errorf("component %s is registered more than once", c.name)
+		}
+		byName[c.name] = c
+	}
+
+	level := make(map[string]int, len(cs.list))
+	visiting := make(map[string]bool)
+
+	var visit func(c *component) (int, error)
+	visit = func(c *component) (int, error) {
+		if l, ok := level[c.name]; ok {
+			return l, nil
+		}
+		if visiting[c.name] {
+			return 0, fmt.Errorf("component %s has circular dependency", c.name)
+		}
+		visiting[c.name] = true
+		l := 0
+		for _, name := range c.opts.DependsOn {
+			dep, ok := byName[name]
+			if ok == false {
+				return 0, fmt.Errorf("component %s depends on unknown component %s", c.name, name)
+			}
+			dl, err := visit(dep)
+			if err != nil {
+				return 0, err
+			}
+			if dl+1 > l {
+				l = dl + 1
+			}
+		}
+		visiting[c.name] = false
+		level[c.name] = l
+		return l, nil
+	}
+
+	cs.levels = nil
+	for _, c := range cs.list {
+		l, err := visit(c)
+		if err != nil {
+			return err
+		}
+		for len(cs.levels) <= l {
+			cs.levels = append(cs.levels, nil)
+		}
+		cs.levels[l] = append(cs.levels[l], c)
+	}
+	return nil
+}
+
+// starts components level by level, components of one level are started in parallel.
+// it stops at the first level in which any component failed, the started components are not stopped.
+func (cs *components) start(ctx context.Context) error {
+	cs.mx.Lock()
+	defer cs.mx.Unlock()
+
+	if err := cs.resolve(); err != nil {
+		return err
+	}
+
+	for _, lvl := range cs.levels {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		errs := cs.each(lvl, func(c *component) error {
+			cctx, cancel := withTimeout(ctx, c.opts.StartTimeout)
+			defer cancel()
+			if err := c.c.Start(cctx); err != nil {
+				return &ComponentError{Name: c.name, Op: "start", Err: err}
+			}
+			c.started = true
+			return nil
+		})
+		if len(errs) > 0 {
+			return errs.err()
+		}
+	}
+	return nil
+}
+
+// stops started components in the reverse order of their start
+func (cs *components) stop(ctx context.Context) error {
+	cs.mx.Lock()
+	defer cs.mx.Unlock()
+
+	var errs Errors
+	for i := len(cs.levels) - 1; i >= 0; i-- {
+		errs = append(errs, cs.each(cs.levels[i], func(c *component) error {
+			if c.started == false {
+				return nil
+			}
+			c.started = false
+			cctx, cancel := withTimeout(ctx, c.opts.StopTimeout)
+			defer cancel()
+			if err := c.c.Stop(cctx); err != nil {
+				return &ComponentError{Name: c.name, Op: "stop", Err: err}
+			}
+			return nil
+		})...)
+	}
+	return errs.err()
+}
+
+// reloads started components in order of their start
+func (cs *components) reload(ctx context.Context) Errors {
+	cs.mx.Lock()
+	defer cs.mx.Unlock()
+
+	var errs Errors
+	for _, lvl := range cs.levels {
+		for _, c := range lvl {
+			r, ok := c.c.(Reloader)
+			if ok == false || c.started == false {
+				continue
+			}
+			if err := r.Reload(ctx); err != nil {
+				errs = append(errs, &ComponentError{Name: c.name, Op: "reload", Err: err})
+			}
+		}
+	}
+	return errs
+}
+
+// calls fn for each component in parallel and collects errors in order of the components
+func (cs *components) each(lvl []*component, fn func(c *component) error) Errors {
+	results := make([]error, len(lvl))
+	wg := new(sync.WaitGroup)
+	for k := range lvl {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			results[k] = fn(lvl[k])
+		}(k)
+	}
+	wg.Wait()
+
+	var errs Errors
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
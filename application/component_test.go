@@ -0,0 +1,223 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	mx     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mx.Lock()
+	r.events = append(r.events, event)
+	r.mx.Unlock()
+}
+
+func (r *recorder) index(event string) int {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	for k, e := range r.events {
+		if e == event {
+			return k
+		}
+	}
+	return -1
+}
+
+func (r *recorder) component(name string, startErr error) Component {
+	return ComponentFuncs{
+		StartFunc: func(ctx context.Context) error {
+			r.add("start " + name)
+			return startErr
+		},
+		StopFunc: func(ctx context.Context) error {
+			r.add("stop " + name)
+			return nil
+		},
+	}
+}
+
+func TestComponentsOrder(t *testing.T) {
+	rec := new(recorder)
+	app := NewApplication()
+	app.Register("grpc", rec.component("grpc", nil), ComponentOptions{DependsOn: []string{"cache", "db"}})
+	app.Register("cache", rec.component("cache", nil), ComponentOptions{DependsOn: []string{"db"}})
+	app.Register("db", rec.component("db", nil), ComponentOptions{})
+	app.Register("metrics", rec.component("metrics", nil), ComponentOptions{})
+	app.OnStop(func() { rec.add("stop task") })
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		app.Stop()
+	}()
+
+	app.Run()
+	if err := app.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	before := func(a, b string) {
+		if ia, ib := rec.index(a), rec.index(b); ia < 0 || ib < 0 || ia > ib {
+			t.Errorf("expected %q before %q in %v", a, b, rec.events)
+		}
+	}
+	before("start db", "start cache")
+	before("start cache", "start grpc")
+	before("stop grpc", "stop cache")
+	before("stop cache", "stop db")
+	before("stop db", "stop task")
+	before("stop metrics", "stop task")
+}
+
+func TestComponentStartFailure(t *testing.T) {
+	rec := new(recorder)
+	boom := errors.New("boom")
+	app := NewApplication()
+	app.Register("db", rec.component("db", nil), ComponentOptions{})
+	app.Register("cache", rec.component("cache", boom), ComponentOptions{DependsOn: []string{"db"}})
+	app.Register("grpc", rec.component("grpc", nil), ComponentOptions{DependsOn: []string{"cache"}})
+
+	app.Run()
+	err := app.Err()
+	var ce *ComponentError
+	if errors.As(err, &ce) == false || ce.Name != "cache" || errors.Is(err, boom) == false {
+		t.Fatalf("expected cache's start error, got %v", err)
+	}
+	if rec.index("start grpc") > -1 {
+		t.Error("dependent component has been started")
+	}
+	if rec.index("stop db") < 0 || rec.index("stop cache") > -1 {
+		t.Errorf("expected only started components to be stopped, got %v", rec.events)
+	}
+}
+
+func TestComponentTimeouts(t *testing.T) {
+	app := NewApplication()
+	app.Register("slow", ComponentFuncs{
+		StopFunc: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}, ComponentOptions{StopTimeout: 50 * time.Millisecond})
+	app.Register("broken", ComponentFuncs{
+		StopFunc: func(ctx context.Context) error {
+			return errors.New("broken")
+		},
+	}, ComponentOptions{})
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		app.Stop()
+	}()
+
+	app.Run()
+	err := app.Err()
+	errs, ok := err.(Errors)
+	if ok == false || len(errs) != 2 || errors.Is(errs[0], context.DeadlineExceeded) == false {
+		t.Fatalf("expected aggregated stop errors, got %v", err)
+	}
+}
+
+func TestComponentDependencyErrors(t *testing.T) {
+	app := NewApplication()
+	app.Register("a", ComponentFuncs{}, ComponentOptions{DependsOn: []string{"b"}})
+	app.Register("b", ComponentFuncs{}, ComponentOptions{DependsOn: []string{"a"}})
+	app.Run()
+	if err := app.Err(); err == nil {
+		t.Fatal("expected circular dependency error")
+	}
+
+	app = NewApplication()
+	app.Register("a", ComponentFuncs{}, ComponentOptions{DependsOn: []string{"missing"}})
+	app.Run()
+	if err := app.Err(); err == nil {
+		t.Fatal("expected unknown dependency error")
+	}
+}
+
+func TestComponentStartCancelledByStop(t *testing.T) {
+	app := NewApplication()
+	stopped := make(chan struct{})
+	app.Register("hanging", ComponentFuncs{
+		StartFunc: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		StopFunc: func(ctx context.Context) error {
+			close(stopped)
+			return nil
+		},
+	}, ComponentOptions{})
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		app.Stop()
+	}()
+
+	app.Run()
+	if err := app.Err(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stopped:
+		t.Fatal("component which has not started must not be stopped")
+	default:
+	}
+}
+
+type reloadable struct {
+	ComponentFuncs
+	reloads int
+	err     error
+}
+
+func (r *reloadable) Reload(ctx context.Context) error {
+	r.reloads++
+	return r.err
+}
+
+func TestReload(t *testing.T) {
+	app := NewApplication()
+	boom := errors.New("boom")
+	comp := &reloadable{err: boom}
+	var hooks int
+	app.Register("rotator", comp, ComponentOptions{})
+	app.OnReload(func() error {
+		hooks++
+		return nil
+	})
+
+	result := make(chan error, 1)
+	app.Register("trigger", ComponentFuncs{
+		StartFunc: func(ctx context.Context) error {
+			go func() {
+				result <- app.Reload()
+				app.Stop()
+			}()
+			return nil
+		},
+	}, ComponentOptions{DependsOn: []string{"rotator"}})
+
+	app.Run()
+	if err := app.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := <-result
+	var ce *ComponentError
+	if errors.As(err, &ce) == false || ce.Op != "reload" || errors.Is(err, boom) == false {
+		t.Fatalf("expected component's reload error, got %v", err)
+	}
+	if hooks != 1 || comp.reloads != 1 {
+		t.Fatalf("expected one reload, got %d hooks and %d components", hooks, comp.reloads)
+	}
+	if err := app.Reload(); err != ErrStopping {
+		t.Fatalf("expected stopping error, got %v", err)
+	}
+}
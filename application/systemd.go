@@ -0,0 +1,149 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemd notify protocol states, see sd_notify(3)
+const (
+	SdReady     = "READY=1"
+	SdStopping  = "STOPPING=1"
+	SdReloading = "RELOADING=1"
+	SdWatchdog  = "WATCHDOG=1"
+)
+
+// returned when the process has not been started by systemd with notify socket
+var ErrNoNotifySocket = errors.New("notify socket is not set")
+
+// Notifier sends state changes to systemd over the unix datagram socket from NOTIFY_SOCKET
+type Notifier struct {
+	addr *net.UnixAddr
+}
+
+// returns nil if NOTIFY_SOCKET is not set, nil notifier ignores all notifications
+func NewNotifier() *Notifier {
+	return NewNotifierAt(os.Getenv("NOTIFY_SOCKET"))
+}
+
+// path starting with "@" is in the abstract namespace
+func NewNotifierAt(path string) *Notifier {
+	if path == "" {
+		return nil
+	}
+	if path[0] == '@' {
+		path = "\x00" + path[1:]
+	}
+	return &Notifier{addr: &net.UnixAddr{Name: path, Net: "unixgram"}}
+}
+
+// sends states, ie. SdReady or "STATUS=...", in one datagram
+func (n *Notifier) Notify(states ...string) error {
+	if n == nil {
+		return ErrNoNotifySocket
+	}
+	conn, err := net.DialUnix("unixgram", nil, n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(strings.Join(states, "\n")))
+	return err
+}
+
+func (n *Notifier) Ready() error {
+	return n.Notify(SdReady)
+}
+
+func (n *Notifier) Stopping() error {
+	return n.Notify(SdStopping)
+}
+
+func (n *Notifier) Reloading() error {
+	return n.Notify(SdReloading)
+}
+
+func (n *Notifier) Watchdog() error {
+	return n.Notify(SdWatchdog)
+}
+
+func (n *Notifier) Status(status string) error {
+	return n.Notify("STATUS=" + status)
+}
+
+// returns the watchdog timeout from WATCHDOG_USEC, zero means the watchdog is not enabled for this process
+func WatchdogTimeout() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || v <= 0 {
+		return 0, errors.New("invalid WATCHDOG_USEC value " + usec)
+	}
+	return time.Duration(v) * time.Microsecond, nil
+}
+
+// HealthStatus is satisfied by workers.Monitor
+type HealthStatus interface {
+	Status() bool
+}
+
+// pings the watchdog at half of the timeout until the context is cancelled.
+// if health is provided the watchdog is pinged only while it is healthy so systemd restarts the unhealthy process.
+func (n *Notifier) RunWatchdog(ctx context.Context, timeout time.Duration, health HealthStatus) {
+	if n == nil || timeout <= 0 {
+		return
+	}
+	t := time.NewTicker(timeout / 2)
+	defer t.Stop()
+	for {
+		if health == nil || health.Status() {
+			n.Watchdog()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// notifies systemd once the application is ready and once it is stopping, and runs the watchdog
+// while the application is running, if it is enabled. it does nothing if the process has not been started by systemd.
+// it has to be called before the application runs.
+func NotifySystemd(app Application, health HealthStatus) *Notifier {
+	n := NewNotifier()
+	if n == nil {
+		return nil
+	}
+
+	timeout, _ := WatchdogTimeout()
+
+	go func() {
+		select {
+		case <-app.Ready():
+		case <-app.Stopping():
+			n.Stopping()
+			return
+		}
+		n.Ready()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go n.RunWatchdog(ctx, timeout, health)
+
+		<-app.Stopping()
+		cancel()
+		n.Stopping()
+	}()
+
+	return n
+}
@@ -0,0 +1,113 @@
+package application
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func listenNotify(t *testing.T) (*net.UnixConn, string) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip("unix datagram sockets are not supported: ", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, path
+}
+
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotifier(t *testing.T) {
+	conn, path := listenNotify(t)
+	n := NewNotifierAt(path)
+
+	if err := n.Notify(SdReady, "STATUS=serving"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readNotify(t, conn); msg != "READY=1\nSTATUS=serving" {
+		t.Fatalf("unexpected message %q", msg)
+	}
+
+	var none *Notifier
+	if err := none.Ready(); err != ErrNoNotifySocket {
+		t.Fatalf("expected missing socket error, got %v", err)
+	}
+}
+
+type health struct {
+	ok int32
+}
+
+func (h *health) Status() bool {
+	return atomic.LoadInt32(&h.ok) == 1
+}
+
+func TestWatchdog(t *testing.T) {
+	conn, path := listenNotify(t)
+	n := NewNotifierAt(path)
+
+	os.Setenv("WATCHDOG_USEC", "40000")
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	timeout, err := WatchdogTimeout()
+	if err != nil || timeout != 40*time.Millisecond {
+		t.Fatalf("unexpected timeout %s %v", timeout, err)
+	}
+
+	h := &health{ok: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.RunWatchdog(ctx, timeout, h)
+
+	if msg := readNotify(t, conn); msg != SdWatchdog {
+		t.Fatalf("unexpected message %q", msg)
+	}
+
+	// unhealthy process stops pinging so reading times out once the pending pings are drained
+	atomic.StoreInt32(&h.ok, 0)
+	time.Sleep(30 * time.Millisecond)
+	for {
+		conn.SetReadDeadline(time.Now().Add(60 * time.Millisecond))
+		if _, err := conn.Read(make([]byte, 64)); err != nil {
+			break
+		}
+	}
+}
+
+func TestNotifySystemd(t *testing.T) {
+	conn, path := listenNotify(t)
+	os.Setenv("NOTIFY_SOCKET", path)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	app := NewApplication()
+	NotifySystemd(app, nil)
+	go func() {
+		buf := make([]byte, 64)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if n, _ := conn.Read(buf); string(buf[:n]) != SdReady {
+			t.Errorf("expected ready, got %q", buf[:n])
+		}
+		app.Stop()
+	}()
+	app.Run()
+
+	if msg := readNotify(t, conn); msg != SdStopping {
+		t.Fatalf("expected stopping, got %q", msg)
+	}
+}
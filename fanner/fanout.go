@@ -1,7 +1,5 @@
 package fanner
 
-// @todo new version is untested
-
 import "sync"
 
 // FanOut provides one-to-many pipeline
@@ -47,10 +47,10 @@ func TestBufferedFanOut(t *testing.T) {
 		wg := new(sync.WaitGroup)
 		wg.Add(len(values))
 		for _, value := range values {
-			go func() {
+			go func(topic, value string) {
 				fo.Send(topic, value)
 				wg.Done()
-			}()
+			}(topic, value)
 		}
 		wg.Wait()
 
@@ -70,3 +70,94 @@ func TestBufferedFanOut(t *testing.T) {
 		}
 	}
 }
+
+func TestFanOutConcurrent(t *testing.T) {
+	fo := NewOut()
+
+	topics := []string{"foo", "bar", "baz"}
+	const senders = 10
+	const messages = 100
+
+	listeners := new(sync.WaitGroup)
+	for _, topic := range topics {
+		for i := 0; i < 3; i++ {
+			ch := fo.Register(topic, i)
+			listeners.Add(1)
+			go func(topic string, ch <-chan interface{}) {
+				defer listeners.Done()
+				received := 0
+				for v := range ch {
+					if v.(string) != topic {
+						t.Errorf("expected value '%s', got '%s'", topic, v)
+					}
+					received++
+					if received == senders*messages {
+						fo.Unregister(ch)
+					}
+				}
+				if received != senders*messages {
+					t.Errorf("expected %d messages, got %d", senders*messages, received)
+				}
+			}(topic, ch)
+		}
+	}
+
+	wg := new(sync.WaitGroup)
+	for _, topic := range topics {
+		for i := 0; i < senders; i++ {
+			wg.Add(1)
+			go func(topic string) {
+				defer wg.Done()
+				for k := 0; k < messages; k++ {
+					fo.Send(topic, topic)
+				}
+			}(topic)
+		}
+	}
+	wg.Wait()
+
+	// each listener unregisters itself once it receives all messages
+	listeners.Wait()
+}
+
+func TestFanOutUnregister(t *testing.T) {
+	fo := NewOut()
+
+	a := fo.Register("foo", 1)
+	b := fo.Register("foo", 1)
+
+	fo.Unregister(a)
+	if _, ok := <-a; ok {
+		t.Fatal("channel expected to be closed")
+	}
+
+	fo.Send("foo", "a")
+	if v := <-b; v != "a" {
+		t.Fatalf("expected value 'a', got '%v'", v)
+	}
+
+	fo.Unregister(b)
+	if _, ok := <-b; ok {
+		t.Fatal("channel expected to be closed")
+	}
+
+	// sending into topic without listeners is no-op
+	fo.Send("foo", "b")
+	fo.Send("unknown", "b")
+	fo.Send("foo")
+}
+
+func TestFanOutMultipleMessages(t *testing.T) {
+	fo := NewOut()
+
+	ch := fo.Register("foo")
+	values := []interface{}{"a", "b", "c"}
+
+	go fo.Send("foo", values...)
+
+	for k := range values {
+		if v := <-ch; v != values[k] {
+			t.Fatalf("expected value '%v', got '%v'", values[k], v)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package typed
+
+import (
+	"context"
+	"sync"
+)
+
+// FanIn provides many-to-one pipeline.
+type FanIn[T any] interface {
+	// added channel is read until it is closed, removed or the pipeline is closed.
+	Add(ch <-chan T)
+	Remove(ch <-chan T)
+	// the channel is closed once the pipeline is closed.
+	Listen() <-chan T
+	// stops reading all added channels and closes the listening channel.
+	Close()
+}
+
+type in[T any] struct {
+	ctx       context.Context
+	out       chan T
+	listeners map[<-chan T]chan struct{}
+	mx        sync.Mutex
+	wg        sync.WaitGroup
+	policy    Overflow
+	onError   ErrorCallback[T]
+	closed    bool
+	// stops the context watcher once the pipeline is closed
+	done chan struct{}
+}
+
+// pipeline is closed once the context is cancelled.
+// onError is used only with Error overflow policy.
+func NewIn[T any](ctx context.Context, size int, policy Overflow, onError ErrorCallback[T]) FanIn[T] {
+	if size < 1 {
+		size = 1
+	}
+	f := &in[T]{
+		ctx:       ctx,
+		out:       make(chan T, size),
+		listeners: make(map[<-chan T]chan struct{}),
+		policy:    policy,
+		onError:   onError,
+		done:      make(chan struct{}),
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.Close()
+		case <-f.done:
+		}
+	}()
+	return f
+}
+
+func (f *in[T]) Add(ch <-chan T) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if f.closed {
+		return
+	}
+	if _, ok := f.listeners[ch]; ok {
+		return
+	}
+
+	closer := make(chan struct{})
+	f.listeners[ch] = closer
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		for {
+			select {
+			case v, ok := <-ch:
+				if ok == false {
+					return
+				}
+				if send(f.ctx, closer, f.out, v, f.policy, f.onError) == false {
+					return
+				}
+
+			case <-closer:
+				return
+
+			case <-f.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (f *in[T]) Remove(ch <-chan T) {
+	f.mx.Lock()
+	if closer, ok := f.listeners[ch]; ok {
+		close(closer)
+		delete(f.listeners, ch)
+	}
+	f.mx.Unlock()
+}
+
+func (f *in[T]) Listen() <-chan T {
+	return f.out
+}
+
+func (f *in[T]) Close() {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if f.closed {
+		return
+	}
+	f.closed = true
+	close(f.done)
+
+	for k := range f.listeners {
+		close(f.listeners[k])
+		delete(f.listeners, k)
+	}
+	f.wg.Wait()
+	close(f.out)
+}
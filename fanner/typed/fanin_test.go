@@ -0,0 +1,152 @@
+package typed
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFanIn(t *testing.T) {
+	fin := NewIn[string](context.Background(), 2, Block, nil)
+
+	l := fin.Listen()
+	a := make(chan string)
+	b := make(chan string)
+
+	fin.Add(a)
+	fin.Add(b)
+
+	a <- "a"
+	b <- "b"
+
+	if v := <-l; v != "a" {
+		t.Fatalf("expected 'a', got '%v'", v)
+	}
+	if v := <-l; v != "b" {
+		t.Fatalf("expected 'b', got '%v'", v)
+	}
+
+	fin.Close()
+	if _, ok := <-l; ok {
+		t.Fatal("channel expected to be closed")
+	}
+}
+
+func TestFanInBlock(t *testing.T) {
+	fin := NewIn[int](context.Background(), 1, Block, nil)
+
+	const senders = 10
+	const messages = 100
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < senders; i++ {
+		ch := make(chan int)
+		fin.Add(ch)
+		wg.Add(1)
+		go func(ch chan int) {
+			defer wg.Done()
+			for k := 0; k < messages; k++ {
+				ch <- k
+			}
+			close(ch)
+		}(ch)
+	}
+
+	received := 0
+	for received < senders*messages {
+		<-fin.Listen()
+		received++
+	}
+	wg.Wait()
+	fin.Close()
+}
+
+func TestFanInDrop(t *testing.T) {
+	var dropped []int
+	var mx sync.Mutex
+	fin := NewIn[int](context.Background(), 1, Error, func(v int, err error) {
+		if err != ErrOverflow {
+			t.Errorf("expected overflow error, got %v", err)
+		}
+		mx.Lock()
+		dropped = append(dropped, v)
+		mx.Unlock()
+	})
+
+	ch := make(chan int)
+	fin.Add(ch)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	fin.Close()
+
+	if v := <-fin.Listen(); v != 1 {
+		t.Fatalf("expected 1, got %d", v)
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	if len(dropped) != 2 || dropped[0] != 2 || dropped[1] != 3 {
+		t.Fatalf("expected 2 and 3 to be dropped, got %v", dropped)
+	}
+}
+
+func TestFanInContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	fin := NewIn[int](ctx, 1, Block, nil)
+
+	ch := make(chan int)
+	fin.Add(ch)
+	ch <- 1
+	// blocks on full receiver
+	go func() {
+		select {
+		case ch <- 2:
+		case <-time.After(time.Second):
+		}
+	}()
+
+	cancel()
+
+	select {
+	case <-fin.Listen():
+	case <-time.After(time.Second):
+		t.Fatal("expected buffered value")
+	}
+	select {
+	case _, ok := <-fin.Listen():
+		if ok {
+			// value 2 could have been sent before the cancellation was noticed
+			if _, ok := <-fin.Listen(); ok {
+				t.Fatal("channel expected to be closed")
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel expected to be closed")
+	}
+
+	// adding into closed pipeline is no-op
+	fin.Add(make(chan int))
+	fin.Close()
+}
+
+// waits for the number of goroutines to drop to n
+func waitForGoroutines(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected at most %d goroutines, got %d", n, runtime.NumGoroutine())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFanInCloseWithoutContext(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		NewIn[int](context.Background(), 1, Block, nil).Close()
+	}
+	waitForGoroutines(t, before)
+}
@@ -0,0 +1,192 @@
+package typed
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// FanOut provides one-to-many pipeline.
+// listeners can register for topic patterns, ie. "orders.*" matches "orders.created" and
+// "orders.>" matches "orders.eu.created", see Match().
+type FanOut[T any] interface {
+	// creates new listener for provided topic or pattern with optional buffering
+	Register(pattern string, buffer ...int) <-chan T
+	// removes listener and closes it. it does not wait for senders that are blocked on other listeners.
+	Unregister(pipe <-chan T)
+	// delivers the messages to all listeners matching the topic, according to the overflow policy.
+	// returns context's error if either provided or pipeline's context has been cancelled.
+	Send(ctx context.Context, topic string, msg ...T) error
+	// closes all listeners, listeners registered afterwards are closed right away.
+	Close()
+}
+
+type out[T any] struct {
+	ctx       context.Context
+	mx        sync.RWMutex
+	listeners map[<-chan T]*listener[T]
+	policy    Overflow
+	onError   ErrorCallback[T]
+	done      chan struct{}
+	closer    sync.Once
+}
+
+type listener[T any] struct {
+	// senders hold read lock while delivering so the channel is not closed under them
+	mx      sync.RWMutex
+	pattern string
+	ch      chan T
+	done    chan struct{}
+}
+
+// all listeners are closed once the context is cancelled.
+// onError is used only with Error overflow policy.
+func NewOut[T any](ctx context.Context, policy Overflow, onError ErrorCallback[T]) FanOut[T] {
+	f := &out[T]{
+		ctx:       ctx,
+		listeners: make(map[<-chan T]*listener[T]),
+		policy:    policy,
+		onError:   onError,
+		done:      make(chan struct{}),
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.Close()
+		case <-f.done:
+		}
+	}()
+	return f
+}
+
+func (f *out[T]) Close() {
+	f.closer.Do(func() {
+		f.mx.Lock()
+		close(f.done)
+		for pipe, l := range f.listeners {
+			delete(f.listeners, pipe)
+			l.close()
+		}
+		f.mx.Unlock()
+	})
+}
+
+func (l *listener[T]) close() {
+	close(l.done)
+	l.mx.Lock()
+	close(l.ch)
+	l.mx.Unlock()
+}
+
+func (f *out[T]) Register(pattern string, buffer ...int) <-chan T {
+	buff := 0
+	if len(buffer) > 0 && buffer[0] > 0 {
+		buff = buffer[0]
+	}
+	l := &listener[T]{
+		pattern: pattern,
+		ch:      make(chan T, buff),
+		done:    make(chan struct{}),
+	}
+
+	f.mx.Lock()
+	select {
+	case <-f.ctx.Done():
+		close(l.done)
+		close(l.ch)
+	case <-f.done:
+		close(l.done)
+		close(l.ch)
+	default:
+		f.listeners[l.ch] = l
+	}
+	f.mx.Unlock()
+
+	return l.ch
+}
+
+func (f *out[T]) Unregister(pipe <-chan T) {
+	f.mx.Lock()
+	l, ok := f.listeners[pipe]
+	delete(f.listeners, pipe)
+	f.mx.Unlock()
+
+	if ok {
+		l.close()
+	}
+}
+
+func (f *out[T]) Send(ctx context.Context, topic string, messages ...T) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	f.mx.RLock()
+	matched := make([]*listener[T], 0, len(f.listeners))
+	for _, l := range f.listeners {
+		if Match(l.pattern, topic) {
+			matched = append(matched, l)
+		}
+	}
+	f.mx.RUnlock()
+
+	wg := new(sync.WaitGroup)
+	for _, l := range matched {
+		wg.Add(1)
+		go func(l *listener[T]) {
+			defer wg.Done()
+			l.mx.RLock()
+			defer l.mx.RUnlock()
+			for k := range messages {
+				select {
+				case <-l.done:
+					return
+				default:
+				}
+				if send(ctx, l.done, l.ch, messages[k], f.policy, f.onError) == false {
+					return
+				}
+			}
+		}(l)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.ctx.Err()
+}
+
+const (
+	// separates tokens of hierarchical topics, ie. "orders.eu.created"
+	TokenSeparator = "."
+	// matches exactly one token, ie. "orders.*.created"
+	WildcardToken = "*"
+	// matches one or more trailing tokens, ie. "orders.>", it can be used only as the last token
+	WildcardTail = ">"
+)
+
+// returns true if the topic matches the pattern.
+// pattern without wildcards matches only the same topic.
+func Match(pattern, topic string) bool {
+	if pattern == topic {
+		return true
+	}
+
+	p := strings.Split(pattern, TokenSeparator)
+	t := strings.Split(topic, TokenSeparator)
+
+	for k := range p {
+		if p[k] == WildcardTail {
+			return k == len(p)-1 && len(t) > k
+		}
+		if k >= len(t) {
+			return false
+		}
+		if p[k] != WildcardToken && p[k] != t[k] {
+			return false
+		}
+	}
+
+	return len(p) == len(t)
+}
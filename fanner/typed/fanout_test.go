@@ -0,0 +1,198 @@
+package typed
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		topic   string
+		match   bool
+	}{
+		{"orders", "orders", true},
+		{"orders", "orders.eu", false},
+		{"orders.*", "orders.eu", true},
+		{"orders.*", "orders.eu.created", false},
+		{"orders.*.created", "orders.eu.created", true},
+		{"orders.>", "orders.eu.created", true},
+		{"orders.>", "orders", false},
+		{"orders.>.created", "orders.eu.created", false},
+		{"*", "orders", true},
+		{">", "orders.eu", true},
+	}
+
+	for _, c := range cases {
+		if Match(c.pattern, c.topic) != c.match {
+			t.Errorf("pattern '%s' and topic '%s' expected match to be %v", c.pattern, c.topic, c.match)
+		}
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	fo := NewOut[string](context.Background(), Block, nil)
+
+	exact := fo.Register("orders.eu")
+	wildcard := fo.Register("orders.*", 2)
+	other := fo.Register("users.>", 1)
+
+	go fo.Send(context.Background(), "orders.eu", "a", "b")
+
+	for _, ch := range []<-chan string{exact, wildcard} {
+		if v := <-ch; v != "a" {
+			t.Fatalf("expected 'a', got '%s'", v)
+		}
+		if v := <-ch; v != "b" {
+			t.Fatalf("expected 'b', got '%s'", v)
+		}
+	}
+
+	select {
+	case v := <-other:
+		t.Fatalf("unexpected value '%s'", v)
+	default:
+	}
+
+	fo.Unregister(exact)
+	if _, ok := <-exact; ok {
+		t.Fatal("channel expected to be closed")
+	}
+}
+
+func TestFanOutConcurrent(t *testing.T) {
+	fo := NewOut[string](context.Background(), Block, nil)
+
+	topics := []string{"a.foo", "a.bar", "b.baz"}
+	const senders = 10
+	const messages = 100
+
+	listeners := new(sync.WaitGroup)
+	counts := map[string]int{"a.foo": senders * messages, "a.bar": senders * messages, "b.baz": senders * messages, "a.*": 2 * senders * messages}
+	for pattern, expect := range counts {
+		for i := 0; i < 3; i++ {
+			ch := fo.Register(pattern, i)
+			listeners.Add(1)
+			go func(expect int, ch <-chan string) {
+				defer listeners.Done()
+				received := 0
+				for range ch {
+					received++
+					if received == expect {
+						fo.Unregister(ch)
+					}
+				}
+				if received != expect {
+					t.Errorf("expected %d messages, got %d", expect, received)
+				}
+			}(expect, ch)
+		}
+	}
+
+	wg := new(sync.WaitGroup)
+	for _, topic := range topics {
+		for i := 0; i < senders; i++ {
+			wg.Add(1)
+			go func(topic string) {
+				defer wg.Done()
+				for k := 0; k < messages; k++ {
+					if err := fo.Send(context.Background(), topic, topic); err != nil {
+						t.Error(err)
+					}
+				}
+			}(topic)
+		}
+	}
+	wg.Wait()
+	listeners.Wait()
+}
+
+func TestFanOutUnregisterBlocked(t *testing.T) {
+	fo := NewOut[int](context.Background(), Block, nil)
+
+	ch := fo.Register("foo")
+	sent := make(chan error)
+	go func() {
+		sent <- fo.Send(context.Background(), "foo", 1)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	fo.Unregister(ch)
+
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("send expected to be released by unregister")
+	}
+}
+
+func TestFanOutOverflow(t *testing.T) {
+	var dropped int
+	fo := NewOut[int](context.Background(), Error, func(v int, err error) {
+		dropped++
+	})
+
+	ch := fo.Register("foo", 1)
+	if err := fo.Send(context.Background(), "foo", 1, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+	if v := <-ch; v != 1 {
+		t.Fatalf("expected 1, got %d", v)
+	}
+	if dropped != 2 {
+		t.Fatalf("expected 2 dropped values, got %d", dropped)
+	}
+}
+
+func TestFanOutContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	fo := NewOut[int](ctx, Block, nil)
+
+	ch := fo.Register("foo")
+
+	sendCtx, sendCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer sendCancel()
+	if err := fo.Send(sendCtx, "foo", 1); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("channel expected to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel expected to be closed")
+	}
+
+	if err := fo.Send(context.Background(), "foo", 1); err != context.Canceled {
+		t.Fatalf("expected cancelled error, got %v", err)
+	}
+	if _, ok := <-fo.Register("foo"); ok {
+		t.Fatal("channel expected to be closed")
+	}
+}
+
+func TestFanOutClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		fo := NewOut[int](context.Background(), Block, nil)
+		ch := fo.Register("foo")
+		fo.Close()
+		if _, ok := <-ch; ok {
+			t.Fatal("channel expected to be closed")
+		}
+		if _, ok := <-fo.Register("foo"); ok {
+			t.Fatal("channel expected to be closed")
+		}
+		fo.Close()
+	}
+	waitForGoroutines(t, before)
+}
@@ -0,0 +1,47 @@
+// Package typed provides generic, context-aware versions of fanner's pipelines.
+package typed
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrOverflow = errors.New("receiver is full")
+
+// Overflow decides what happens when the receiving channel is full.
+type Overflow int
+
+const (
+	// waits until the receiver has space for the value, the pipeline is closed or the context is cancelled.
+	Block Overflow = iota
+	// value is silently dropped.
+	Drop
+	// value is dropped and the error callback is called with ErrOverflow.
+	Error
+)
+
+// called with the dropped value when Error overflow policy is used
+type ErrorCallback[T any] func(v T, err error)
+
+// sends the value according to the policy. returns false if the pipeline should stop.
+func send[T any](ctx context.Context, done <-chan struct{}, out chan<- T, v T, policy Overflow, onError ErrorCallback[T]) bool {
+	if policy == Block {
+		select {
+		case out <- v:
+			return true
+		case <-done:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	select {
+	case out <- v:
+	default:
+		if policy == Error && onError != nil {
+			onError(v, ErrOverflow)
+		}
+	}
+	return true
+}
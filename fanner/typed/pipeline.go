@@ -0,0 +1,83 @@
+package typed
+
+import (
+	"context"
+	"sync"
+)
+
+// Semaphore limits parallelism of stages, it is satisfied by workers.Semaphore
+// so one semaphore can be shared by multiple stages or pipelines.
+type Semaphore interface {
+	// returns context's error if the slots could not be taken before the context was cancelled
+	TakeContext(ctx context.Context, n uint) error
+	Return(n uint)
+}
+
+// Pipeline groups stages so that the first error cancels all of them.
+// each stage closes its output channel once its input is closed or the pipeline is cancelled.
+type Pipeline struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+func NewPipeline(ctx context.Context) *Pipeline {
+	p := new(Pipeline)
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	return p
+}
+
+// cancelled when any stage fails, the pipeline is cancelled or the parent context is cancelled
+func (p *Pipeline) Context() context.Context {
+	return p.ctx
+}
+
+func (p *Pipeline) Cancel() {
+	p.cancel()
+}
+
+// waits for all stages to finish and returns the first error, if any.
+// it does not return context's error if the pipeline has been cancelled without a failure.
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	p.cancel()
+	return p.err
+}
+
+func (p *Pipeline) fail(err error) {
+	p.once.Do(func() {
+		p.err = err
+		p.cancel()
+	})
+}
+
+func (p *Pipeline) run(fn func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		fn()
+	}()
+}
+
+// sends the value unless the pipeline is cancelled
+func emit[T any](p *Pipeline, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// receives next value unless the input is closed or the pipeline is cancelled
+func next[T any](p *Pipeline, in <-chan T) (T, bool) {
+	select {
+	case v, ok := <-in:
+		return v, ok
+	case <-p.ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
@@ -0,0 +1,350 @@
+package typed
+
+import (
+	"context"
+	"time"
+)
+
+// emits provided values in order
+func Source[T any](p *Pipeline, values ...T) <-chan T {
+	out := make(chan T)
+	p.run(func() {
+		defer close(out)
+		for k := range values {
+			if emit(p, out, values[k]) == false {
+				return
+			}
+		}
+	})
+	return out
+}
+
+// converts values in order, one at a time
+func Map[T, U any](p *Pipeline, in <-chan T, fn func(ctx context.Context, v T) (U, error)) <-chan U {
+	out := make(chan U)
+	p.run(func() {
+		defer close(out)
+		for {
+			v, ok := next(p, in)
+			if ok == false {
+				return
+			}
+			u, err := fn(p.ctx, v)
+			if err != nil {
+				p.fail(err)
+				return
+			}
+			if emit(p, out, u) == false {
+				return
+			}
+		}
+	})
+	return out
+}
+
+// converts values with up to n concurrent calls of fn. if semaphore is provided, each call also takes
+// one slot from it so the parallelism can be limited across multiple stages.
+// if ordered is true, values are emitted in the input order, otherwise as soon as they are converted.
+func ParallelMap[T, U any](p *Pipeline, in <-chan T, n int, sem Semaphore, ordered bool, fn func(ctx context.Context, v T) (U, error)) <-chan U {
+	if n < 1 {
+		n = 1
+	}
+	out := make(chan U)
+
+	call := func(v T) (U, bool) {
+		var zero U
+		if sem != nil {
+			if err := sem.TakeContext(p.ctx, 1); err != nil {
+				return zero, false
+			}
+			defer sem.Return(1)
+		}
+		if p.ctx.Err() != nil {
+			return zero, false
+		}
+		u, err := fn(p.ctx, v)
+		if err != nil {
+			p.fail(err)
+			return zero, false
+		}
+		return u, true
+	}
+
+	if ordered == false {
+		done := make(chan struct{})
+		for i := 0; i < n; i++ {
+			p.run(func() {
+				defer func() { done <- struct{}{} }()
+				for {
+					v, ok := next(p, in)
+					if ok == false {
+						return
+					}
+					u, ok := call(v)
+					if ok == false || emit(p, out, u) == false {
+						return
+					}
+				}
+			})
+		}
+		p.run(func() {
+			for i := 0; i < n; i++ {
+				<-done
+			}
+			close(out)
+		})
+		return out
+	}
+
+	// each value gets its own result channel which are queued in the input order.
+	// the slots limit the number of concurrent calls since the emitter holds one result outside of the queue.
+	results := make(chan chan U, n)
+	slots := make(chan struct{}, n)
+	p.run(func() {
+		defer close(results)
+		for {
+			v, ok := next(p, in)
+			if ok == false {
+				return
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-p.ctx.Done():
+				return
+			}
+			res := make(chan U, 1)
+			select {
+			case results <- res:
+			case <-p.ctx.Done():
+				<-slots
+				return
+			}
+			p.run(func() {
+				defer func() { <-slots }()
+				if u, ok := call(v); ok {
+					res <- u
+				}
+				close(res)
+			})
+		}
+	})
+	p.run(func() {
+		defer close(out)
+		for res := range results {
+			u, ok := <-res
+			if ok == false || emit(p, out, u) == false {
+				// drain the queue so the dispatcher is not blocked
+				for range results {
+				}
+				return
+			}
+		}
+	})
+	return out
+}
+
+// passes through values for which fn returns true, in order
+func Filter[T any](p *Pipeline, in <-chan T, fn func(ctx context.Context, v T) (bool, error)) <-chan T {
+	out := make(chan T)
+	p.run(func() {
+		defer close(out)
+		for {
+			v, ok := next(p, in)
+			if ok == false {
+				return
+			}
+			keep, err := fn(p.ctx, v)
+			if err != nil {
+				p.fail(err)
+				return
+			}
+			if keep && emit(p, out, v) == false {
+				return
+			}
+		}
+	})
+	return out
+}
+
+// groups values into batches of up to size values. batch is emitted once it is full or once interval
+// has passed since its first value, if interval is greater than zero. remaining values are emitted
+// when the input is closed.
+func Batch[T any](p *Pipeline, in <-chan T, size int, interval time.Duration) <-chan []T {
+	if size < 1 {
+		size = 1
+	}
+	out := make(chan []T)
+	p.run(func() {
+		defer close(out)
+
+		var batch []T
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+
+		flush := func() bool {
+			if timer != nil {
+				timer.Stop()
+				timer, timeout = nil, nil
+			}
+			if len(batch) == 0 {
+				return true
+			}
+			b := batch
+			batch = nil
+			return emit(p, out, b)
+		}
+
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+
+			case <-timeout:
+				timer, timeout = nil, nil
+				if flush() == false {
+					return
+				}
+
+			case v, ok := <-in:
+				if ok == false {
+					flush()
+					return
+				}
+				batch = append(batch, v)
+				if len(batch) >= size {
+					if flush() == false {
+						return
+					}
+				} else if len(batch) == 1 && interval > 0 {
+					timer = time.NewTimer(interval)
+					timeout = timer.C
+				}
+			}
+		}
+	})
+	return out
+}
+
+// collapses bursts of values with the same key into the last one which is emitted once no value
+// with that key has been received for the wait duration. pending values are emitted when the input is closed.
+func Debounce[T any, K comparable](p *Pipeline, in <-chan T, wait time.Duration, key func(v T) K) <-chan T {
+	out := make(chan T)
+	p.run(func() {
+		defer close(out)
+
+		type pending struct {
+			value T
+			at    time.Time
+		}
+		var order []K
+		waiting := make(map[K]*pending)
+
+		// pending values are checked twice per wait period
+		var tick <-chan time.Time
+		if wait > 0 {
+			interval := wait / 2
+			if interval <= 0 {
+				interval = wait
+			}
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		// emits values, in order of their first appearance, which have been quiet long enough
+		flush := func(all bool) bool {
+			now := time.Now()
+			kept := order[:0]
+			for _, k := range order {
+				pend := waiting[k]
+				if all || wait <= 0 || now.Sub(pend.at) >= wait {
+					delete(waiting, k)
+					if emit(p, out, pend.value) == false {
+						return false
+					}
+				} else {
+					kept = append(kept, k)
+				}
+			}
+			order = kept
+			return true
+		}
+
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+
+			case <-tick:
+				if flush(false) == false {
+					return
+				}
+
+			case v, ok := <-in:
+				if ok == false {
+					flush(true)
+					return
+				}
+				k := key(v)
+				if pend, ok := waiting[k]; ok {
+					pend.value = v
+					pend.at = time.Now()
+				} else {
+					waiting[k] = &pending{value: v, at: time.Now()}
+					order = append(order, k)
+				}
+				if wait <= 0 && flush(true) == false {
+					return
+				}
+			}
+		}
+	})
+	return out
+}
+
+// merges multiple inputs into one output which is closed once all inputs are closed.
+// order is preserved only for values from the same input.
+func Merge[T any](p *Pipeline, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+	done := make(chan struct{}, len(ins))
+	for _, in := range ins {
+		in := in
+		p.run(func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				v, ok := next(p, in)
+				if ok == false || emit(p, out, v) == false {
+					return
+				}
+			}
+		})
+	}
+	p.run(func() {
+		for range ins {
+			<-done
+		}
+		close(out)
+	})
+	return out
+}
+
+// consumes values in order until the input is closed or fn fails
+func Sink[T any](p *Pipeline, in <-chan T, fn func(ctx context.Context, v T) error) {
+	p.run(func() {
+		for {
+			v, ok := next(p, in)
+			if ok == false {
+				return
+			}
+			if err := fn(p.ctx, v); err != nil {
+				p.fail(err)
+				return
+			}
+		}
+	})
+}
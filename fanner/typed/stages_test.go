@@ -0,0 +1,294 @@
+package typed
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func collect[T any](in <-chan T) []T {
+	var out []T
+	for v := range in {
+		out = append(out, v)
+	}
+	return out
+}
+
+func TestMapFilter(t *testing.T) {
+	p := NewPipeline(context.Background())
+
+	src := Source(p, 1, 2, 3, 4, 5, 6)
+	even := Filter(p, src, func(_ context.Context, v int) (bool, error) {
+		return v%2 == 0, nil
+	})
+	str := Map(p, even, func(_ context.Context, v int) (string, error) {
+		return strconv.Itoa(v), nil
+	})
+
+	out := collect(str)
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 || out[0] != "2" || out[1] != "4" || out[2] != "6" {
+		t.Fatalf("unexpected output %v", out)
+	}
+}
+
+func TestMapError(t *testing.T) {
+	p := NewPipeline(context.Background())
+	fail := errors.New("fail")
+
+	values := make([]int, 100)
+	for k := range values {
+		values[k] = k
+	}
+	out := Map(p, Source(p, values...), func(_ context.Context, v int) (int, error) {
+		if v == 10 {
+			return 0, fail
+		}
+		return v, nil
+	})
+
+	received := collect(out)
+	if err := p.Wait(); err != fail {
+		t.Fatalf("expected error, got %v", err)
+	}
+	if len(received) != 10 {
+		t.Fatalf("expected 10 values before failure, got %d", len(received))
+	}
+}
+
+type testSemaphore struct {
+	slots    chan struct{}
+	current  int32
+	max      int32
+	returned int32
+}
+
+func newTestSemaphore(n uint) *testSemaphore {
+	return &testSemaphore{slots: make(chan struct{}, n)}
+}
+
+func (s *testSemaphore) TakeContext(ctx context.Context, n uint) error {
+	for i := uint(0); i < n; i++ {
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			s.Return(i)
+			return ctx.Err()
+		}
+	}
+	if c := atomic.AddInt32(&s.current, int32(n)); c > atomic.LoadInt32(&s.max) {
+		atomic.StoreInt32(&s.max, c)
+	}
+	return nil
+}
+
+func (s *testSemaphore) Return(n uint) {
+	atomic.AddInt32(&s.current, -int32(n))
+	atomic.AddInt32(&s.returned, int32(n))
+	for i := uint(0); i < n; i++ {
+		<-s.slots
+	}
+}
+
+func TestParallelMap(t *testing.T) {
+	values := make([]int, 100)
+	for k := range values {
+		values[k] = k
+	}
+
+	for _, ordered := range []bool{true, false} {
+		p := NewPipeline(context.Background())
+		sem := newTestSemaphore(2)
+
+		out := ParallelMap(p, Source(p, values...), 5, sem, ordered, func(_ context.Context, v int) (int, error) {
+			time.Sleep(time.Millisecond)
+			return v * 2, nil
+		})
+
+		received := collect(out)
+		if err := p.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		if len(received) != len(values) {
+			t.Fatalf("expected %d values, got %d", len(values), len(received))
+		}
+		sum := 0
+		for k, v := range received {
+			if ordered && v != k*2 {
+				t.Fatalf("expected value %d at %d, got %d", k*2, k, v)
+			}
+			sum += v
+		}
+		if sum != 9900 {
+			t.Fatalf("unexpected sum %d", sum)
+		}
+		if sem.max > 2 {
+			t.Fatalf("semaphore limit exceeded: %d", sem.max)
+		}
+	}
+}
+
+func TestParallelMapLimit(t *testing.T) {
+	values := make([]int, 50)
+	for _, ordered := range []bool{true, false} {
+		p := NewPipeline(context.Background())
+		var current, max int32
+		out := ParallelMap(p, Source(p, values...), 3, nil, ordered, func(_ context.Context, v int) (int, error) {
+			if c := atomic.AddInt32(&current, 1); c > atomic.LoadInt32(&max) {
+				atomic.StoreInt32(&max, c)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&current, -1)
+			return v, nil
+		})
+		// slow consumer keeps the emitter waiting so the queue gets full
+		for range out {
+			time.Sleep(2 * time.Millisecond)
+		}
+		if err := p.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		if max > 3 {
+			t.Fatalf("ordered=%v: expected at most 3 concurrent calls, got %d", ordered, max)
+		}
+	}
+}
+
+func TestParallelMapCancelledSemaphore(t *testing.T) {
+	for _, ordered := range []bool{true, false} {
+		p := NewPipeline(context.Background())
+		// the semaphore is exhausted so the calls wait for it until the pipeline is cancelled
+		sem := newTestSemaphore(1)
+		sem.TakeContext(context.Background(), 1)
+
+		out := ParallelMap(p, Source(p, 1, 2, 3), 2, sem, ordered, func(_ context.Context, v int) (int, error) {
+			t.Error("called without semaphore slot")
+			return v, nil
+		})
+		time.Sleep(10 * time.Millisecond)
+		p.Cancel()
+		collect(out)
+		p.Wait()
+
+		if r := atomic.LoadInt32(&sem.returned); r != 0 {
+			t.Fatalf("ordered=%v: returned %d slots which were not taken", ordered, r)
+		}
+	}
+}
+
+func TestParallelMapError(t *testing.T) {
+	fail := errors.New("fail")
+	values := make([]int, 100)
+	for k := range values {
+		values[k] = k
+	}
+
+	for _, ordered := range []bool{true, false} {
+		p := NewPipeline(context.Background())
+		out := ParallelMap(p, Source(p, values...), 4, nil, ordered, func(_ context.Context, v int) (int, error) {
+			if v == 50 {
+				return 0, fail
+			}
+			return v, nil
+		})
+		collect(out)
+		if err := p.Wait(); err != fail {
+			t.Fatalf("expected error, got %v", err)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	p := NewPipeline(context.Background())
+
+	in := make(chan int)
+	out := Batch(p, in, 3, 20*time.Millisecond)
+
+	go func() {
+		for i := 0; i < 4; i++ {
+			in <- i
+		}
+		// last value is flushed by the interval
+		time.Sleep(50 * time.Millisecond)
+		in <- 4
+		close(in)
+	}()
+
+	batches := collect(out)
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 3 || len(batches[0]) != 3 || len(batches[1]) != 1 || batches[1][0] != 3 || len(batches[2]) != 1 {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	p := NewPipeline(context.Background())
+
+	in := make(chan string)
+	out := Debounce(p, in, 20*time.Millisecond, func(v string) byte { return v[0] })
+
+	go func() {
+		for _, v := range []string{"a1", "b1", "a2", "a3", "b2"} {
+			in <- v
+		}
+		time.Sleep(50 * time.Millisecond)
+		in <- "a4"
+		close(in)
+	}()
+
+	values := collect(out)
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 3 || values[0] != "a3" || values[1] != "b2" || values[2] != "a4" {
+		t.Fatalf("unexpected values %v", values)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	p := NewPipeline(context.Background())
+
+	out := Merge(p, Source(p, 1, 2, 3), Source(p, 4, 5), Source[int](p))
+
+	var sum int
+	Sink(p, out, func(_ context.Context, v int) error {
+		sum += v
+		return nil
+	})
+
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 15 {
+		t.Fatalf("expected sum 15, got %d", sum)
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewPipeline(ctx)
+
+	in := make(chan int)
+	out := Merge(p, Batch(p, Map(p, in, func(_ context.Context, v int) (int, error) { return v, nil }), 10, time.Second))
+	Sink(p, out, func(context.Context, []int) error { return nil })
+
+	cancel()
+
+	done := make(chan error)
+	go func() { done <- p.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pipeline expected to stop once cancelled")
+	}
+}
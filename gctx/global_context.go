@@ -2,46 +2,222 @@ package gctx
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
+// returned by all functions when the context, or its parent, was not created by New()
+var ErrNotGroupContext = errors.New("context was not created by gctx.New")
+
 type features struct {
 	wg     sync.WaitGroup
 	cancel context.CancelFunc
 	once   sync.Once
+	mx     sync.Mutex
+	nextId uint64
+	tasks  map[uint64]Task
+	err    error
 }
 
 type key struct{}
 
+// Task describes running task started by Go()
+type Task struct {
+	Name    string
+	Started time.Time
+}
+
+// PanicError is returned by a task which panicked
+type PanicError struct {
+	Task  string
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task %s panicked: %v", e.Task, e.Value)
+}
+
+// TimeoutError is returned by Wait() when the tasks did not finish in time
+type TimeoutError struct {
+	// tasks which were still running, the longest running first
+	Running []Task
+}
+
+func (e *TimeoutError) Error() string {
+	names := make([]string, 0, len(e.Running))
+	for _, t := range e.Running {
+		names = append(names, t.Name)
+	}
+	return "timed out waiting for tasks: " + strings.Join(names, ", ")
+}
+
 func New() context.Context {
-	var f features
+	f := &features{tasks: make(map[uint64]Task)}
 	ctx, cancel := context.WithCancel(context.Background())
 	f.cancel = cancel
-	ctx = context.WithValue(ctx, key{}, &f)
+	ctx = context.WithValue(ctx, key{}, f)
 	return ctx
 }
 
-func Cancel(ctx context.Context) {
-	f := ctx.Value(key{}).(*features)
+func get(ctx context.Context) (*features, error) {
+	if ctx == nil {
+		return nil, ErrNotGroupContext
+	}
+	f, ok := ctx.Value(key{}).(*features)
+	if ok == false {
+		return nil, ErrNotGroupContext
+	}
+	return f, nil
+}
+
+func Cancel(ctx context.Context) error {
+	f, err := get(ctx)
+	if err != nil {
+		return err
+	}
 	f.cancel()
+	return nil
 }
 
-func Add(ctx context.Context, num int) {
-	f := ctx.Value(key{}).(*features)
+func Add(ctx context.Context, num int) error {
+	f, err := get(ctx)
+	if err != nil {
+		return err
+	}
 	f.wg.Add(num)
+	return nil
 }
 
-func Done(ctx context.Context) {
-	f := ctx.Value(key{}).(*features)
+func Done(ctx context.Context) error {
+	f, err := get(ctx)
+	if err != nil {
+		return err
+	}
 	f.wg.Done()
+	return nil
 }
 
-func Wait(ctx context.Context) {
-	f := ctx.Value(key{}).(*features)
-	f.wg.Wait()
+// waits for all tasks and returns the first error returned by a task started by Go().
+// if timeout is provided and the tasks do not finish in time, it returns *TimeoutError with the running tasks.
+// note: this changes the former Wait(ctx) which returned nothing. calls used as a statement still compile,
+// but code which uses Wait as a func(context.Context) value has to be updated.
+func Wait(ctx context.Context, timeout ...time.Duration) error {
+	f, err := get(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(timeout) == 0 || timeout[0] <= 0 {
+		f.wg.Wait()
+		return f.firstErr()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+
+	t := time.NewTimer(timeout[0])
+	defer t.Stop()
+	select {
+	case <-done:
+		return f.firstErr()
+	case <-t.C:
+		return &TimeoutError{Running: f.running()}
+	}
 }
 
-func Once(ctx context.Context, fn func()) {
-	f := ctx.Value(key{}).(*features)
+func Once(ctx context.Context, fn func()) error {
+	f, err := get(ctx)
+	if err != nil {
+		return err
+	}
 	f.once.Do(fn)
+	return nil
+}
+
+// runs fn in a new goroutine tracked by the context. the first task which fails cancels the context,
+// panic of the task is recovered and returned as *PanicError.
+func Go(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	f, err := get(ctx)
+	if err != nil {
+		return err
+	}
+
+	f.mx.Lock()
+	f.nextId++
+	id := f.nextId
+	f.tasks[id] = Task{Name: name, Started: time.Now()}
+	f.mx.Unlock()
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+
+		err := run(ctx, name, fn)
+
+		f.mx.Lock()
+		delete(f.tasks, id)
+		if err != nil && f.err == nil {
+			f.err = err
+			f.cancel()
+		}
+		f.mx.Unlock()
+	}()
+	return nil
+}
+
+func run(ctx context.Context, name string, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Task: name, Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn(ctx)
+}
+
+// returns the first error returned by a task
+func Err(ctx context.Context) error {
+	f, err := get(ctx)
+	if err != nil {
+		return err
+	}
+	return f.firstErr()
+}
+
+// returns the running tasks, the longest running first. useful for finding out what blocks the shutdown.
+func Tasks(ctx context.Context) ([]Task, error) {
+	f, err := get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return f.running(), nil
+}
+
+func (f *features) firstErr() error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.err
+}
+
+func (f *features) running() []Task {
+	f.mx.Lock()
+	ids := make([]uint64, 0, len(f.tasks))
+	for id := range f.tasks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	out := make([]Task, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, f.tasks[id])
+	}
+	f.mx.Unlock()
+	return out
 }
@@ -0,0 +1,101 @@
+package gctx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGoFirstErrorCancels(t *testing.T) {
+	ctx := New()
+	boom := errors.New("boom")
+
+	Go(ctx, "waiter", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	Go(ctx, "failing", func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		return boom
+	})
+
+	if err := Wait(ctx); err != boom {
+		t.Fatalf("expected first error, got %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("expected cancelled context")
+	}
+}
+
+func TestGoPanic(t *testing.T) {
+	ctx := New()
+	Go(ctx, "panicking", func(ctx context.Context) error {
+		panic("oops")
+	})
+
+	var pe *PanicError
+	if err := Wait(ctx); errors.As(err, &pe) == false || pe.Task != "panicking" || pe.Value != "oops" {
+		t.Fatalf("expected panic error, got %v", err)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	ctx := New()
+	release := make(chan struct{})
+	Go(ctx, "stuck", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	Go(ctx, "quick", func(ctx context.Context) error { return nil })
+
+	var te *TimeoutError
+	err := Wait(ctx, 20*time.Millisecond)
+	if errors.As(err, &te) == false || len(te.Running) != 1 || te.Running[0].Name != "stuck" {
+		t.Fatalf("expected timeout with the stuck task, got %v", err)
+	}
+
+	tasks, _ := Tasks(ctx)
+	if len(tasks) != 1 || tasks[0].Name != "stuck" {
+		t.Fatalf("unexpected running tasks %v", tasks)
+	}
+
+	close(release)
+	if err := Wait(ctx, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForeignContext(t *testing.T) {
+	ctx := context.Background()
+	if err := Go(ctx, "task", func(ctx context.Context) error { return nil }); err != ErrNotGroupContext {
+		t.Fatalf("expected foreign context error, got %v", err)
+	}
+	if err := Wait(ctx); err != ErrNotGroupContext {
+		t.Fatalf("expected foreign context error, got %v", err)
+	}
+	called := false
+	for name, err := range map[string]error{
+		"cancel": Cancel(ctx),
+		"add":    Add(ctx, 1),
+		"done":   Done(ctx),
+		"once":   Once(ctx, func() { called = true }),
+	} {
+		if err != ErrNotGroupContext {
+			t.Errorf("%s: expected foreign context error, got %v", name, err)
+		}
+	}
+	if called {
+		t.Error("once has been called on foreign context")
+	}
+
+	// derived context still belongs to the group
+	derived, cancel := context.WithTimeout(New(), time.Second)
+	defer cancel()
+	if err := Go(derived, "task", func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := Wait(derived); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/ivanjaros/ijlibs/health
+
+go 1.17
@@ -0,0 +1,252 @@
+// Package health exposes Kubernetes style /healthz, /readyz and /livez endpoints.
+//
+// liveness reports only liveness checks, readiness reports readiness checks, statuses of the monitor
+// and turns unready once the application is stopping, health reports everything.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ivanjaros/ijlibs/workers"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeout = 5 * time.Second
+
+	StatusOk   = "ok"
+	StatusFail = "fail"
+)
+
+type Check func(ctx context.Context) error
+
+type Kind int
+
+const (
+	// failing liveness check means the process should be restarted
+	Liveness Kind = 1 << iota
+	// failing readiness check means the process should not receive traffic
+	Readiness
+)
+
+type CheckOptions struct {
+	// Liveness, Readiness or both, defaults to Readiness
+	Kind Kind
+	// defaults to DefaultTimeout
+	Timeout time.Duration
+	// how long the result is reused before the check runs again, zero means it runs on each request
+	CacheTTL time.Duration
+}
+
+type CheckResult struct {
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	Checked  time.Time `json:"checked"`
+	Cached   bool      `json:"cached,omitempty"`
+}
+
+// monitor statuses and shutdown are reported apart from the checks so they cannot collide with their names
+type Report struct {
+	Status   string                 `json:"status"`
+	Checks   map[string]CheckResult `json:"checks,omitempty"`
+	Monitor  map[string]CheckResult `json:"monitor,omitempty"`
+	Shutdown *CheckResult           `json:"shutdown,omitempty"`
+}
+
+// monitor is optional, its statuses are reported as readiness checks
+func New(monitor workers.Monitor) *Health {
+	return &Health{monitor: monitor, checks: make(map[string]*check)}
+}
+
+type Health struct {
+	mx       sync.RWMutex
+	monitor  workers.Monitor
+	checks   map[string]*check
+	stopping bool
+}
+
+type check struct {
+	mx     sync.Mutex
+	name   string
+	fn     Check
+	opts   CheckOptions
+	result *CheckResult
+}
+
+// adds or replaces the check
+func (h *Health) AddCheck(name string, fn Check, opts CheckOptions) *Health {
+	if opts.Kind == 0 {
+		opts.Kind = Readiness
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	h.mx.Lock()
+	h.checks[name] = &check{name: name, fn: fn, opts: opts}
+	h.mx.Unlock()
+	return h
+}
+
+func (h *Health) RemoveCheck(name string) {
+	h.mx.Lock()
+	delete(h.checks, name)
+	h.mx.Unlock()
+}
+
+// marks the process as not ready, ie. once the application starts shutting down
+func (h *Health) Shutdown() {
+	h.mx.Lock()
+	h.stopping = true
+	h.mx.Unlock()
+}
+
+// calls Shutdown() once the channel is closed, ie. h.ShutdownOn(app.Stopping())
+func (h *Health) ShutdownOn(stopping <-chan struct{}) *Health {
+	go func() {
+		<-stopping
+		h.Shutdown()
+	}()
+	return h
+}
+
+// runs checks of the kind, zero kind means all checks
+func (h *Health) Report(ctx context.Context, kind Kind) Report {
+	h.mx.RLock()
+	checks := make([]*check, 0, len(h.checks))
+	for _, c := range h.checks {
+		if kind == 0 || c.opts.Kind&kind > 0 {
+			checks = append(checks, c)
+		}
+	}
+	stopping := h.stopping
+	monitor := h.monitor
+	h.mx.RUnlock()
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].name < checks[j].name })
+
+	results := make([]CheckResult, len(checks))
+	wg := new(sync.WaitGroup)
+	for k := range checks {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			results[k] = checks[k].run(ctx)
+		}(k)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOk, Checks: make(map[string]CheckResult, len(checks))}
+	for k, c := range checks {
+		report.Checks[c.name] = results[k]
+		if results[k].Status != StatusOk {
+			report.Status = StatusFail
+		}
+	}
+
+	if kind == 0 || kind&Readiness > 0 {
+		now := time.Now()
+		if monitor != nil {
+			statuses := monitor.Statuses()
+			report.Monitor = make(map[string]CheckResult, len(statuses))
+			for name, ok := range statuses {
+				res := CheckResult{Status: StatusOk, Checked: now}
+				if ok == false {
+					res.Status = StatusFail
+					report.Status = StatusFail
+				}
+				report.Monitor[name] = res
+			}
+		}
+		if stopping {
+			report.Status = StatusFail
+			report.Shutdown = &CheckResult{Status: StatusFail, Error: "shutting down", Checked: now}
+		}
+	}
+
+	return report
+}
+
+func (c *check) run(parent context.Context) CheckResult {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.result != nil && c.opts.CacheTTL > 0 && time.Since(c.result.Checked) < c.opts.CacheTTL {
+		res := *c.result
+		res.Cached = true
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(parent, c.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.fn(ctx)
+	}()
+
+	// check which ignores the context does not block the response
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := CheckResult{Status: StatusOk, Duration: time.Since(start).String(), Checked: start}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	// the check has been interrupted by the caller, ie. client has disconnected, so its result
+	// does not say anything about the checked dependency
+	if parent.Err() == nil {
+		c.result = &res
+	}
+	return res
+}
+
+func (h *Health) handler(kind Kind) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Report(r.Context(), kind)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status == StatusOk {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if r.Method != http.MethodHead {
+			json.NewEncoder(w).Encode(report)
+		}
+	})
+}
+
+// reports all checks
+func (h *Health) Healthz() http.Handler {
+	return h.handler(0)
+}
+
+// reports readiness checks, monitor and shutdown
+func (h *Health) Readyz() http.Handler {
+	return h.handler(Readiness)
+}
+
+// reports liveness checks
+func (h *Health) Livez() http.Handler {
+	return h.handler(Liveness)
+}
+
+// serves /healthz, /readyz and /livez
+func (h *Health) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", h.Healthz())
+	mux.Handle("/readyz", h.Readyz())
+	mux.Handle("/livez", h.Livez())
+	return mux
+}
@@ -0,0 +1,140 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ivanjaros/ijlibs/workers"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, h http.Handler, path string) (int, Report) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, report
+}
+
+func TestEndpoints(t *testing.T) {
+	mon := workers.NewMonitor()
+	h := New(mon)
+	h.AddCheck("db", func(ctx context.Context) error { return nil }, CheckOptions{})
+	h.AddCheck("deadlock", func(ctx context.Context) error { return nil }, CheckOptions{Kind: Liveness})
+	handler := h.Handler()
+
+	for _, path := range []string{"/healthz", "/readyz", "/livez"} {
+		if code, report := get(t, handler, path); code != http.StatusOK || report.Status != StatusOk {
+			t.Fatalf("%s: expected ok, got %d %+v", path, code, report)
+		}
+	}
+
+	mon.Push("smtp", false)
+	code, report := get(t, handler, "/readyz")
+	if code != http.StatusServiceUnavailable || report.Monitor["smtp"].Status != StatusFail {
+		t.Fatalf("expected failing monitor status, got %d %+v", code, report)
+	}
+	if _, ok := report.Checks["deadlock"]; ok {
+		t.Fatal("liveness check reported by readiness")
+	}
+	if code, _ := get(t, handler, "/livez"); code != http.StatusOK {
+		t.Fatal("monitor must not affect liveness")
+	}
+}
+
+func TestCheckTimeoutAndCache(t *testing.T) {
+	h := New(nil)
+	var calls int32
+	h.AddCheck("slow", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Second)
+		return nil
+	}, CheckOptions{Timeout: 20 * time.Millisecond, CacheTTL: time.Minute})
+
+	start := time.Now()
+	report := h.Report(context.Background(), 0)
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("timeout has not been applied")
+	}
+	res := report.Checks["slow"]
+	if res.Status != StatusFail || res.Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("expected timeout, got %+v", res)
+	}
+
+	report = h.Report(context.Background(), 0)
+	if report.Checks["slow"].Cached == false || atomic.LoadInt32(&calls) != 1 {
+		t.Fatal("expected cached result")
+	}
+}
+
+func TestCancelledCheckIsNotCached(t *testing.T) {
+	h := New(nil)
+	var calls int32
+	h.AddCheck("db", func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}, CheckOptions{Timeout: time.Second, CacheTTL: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if res := h.Report(ctx, 0).Checks["db"]; res.Status != StatusFail {
+		t.Fatalf("expected interrupted check to fail, got %+v", res)
+	}
+
+	res := h.Report(context.Background(), 0).Checks["db"]
+	if res.Status != StatusOk || res.Cached {
+		t.Fatalf("expected fresh result, got %+v", res)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	h := New(nil)
+	h.AddCheck("broken", func(ctx context.Context) error { return errors.New("broken") }, CheckOptions{Kind: Liveness})
+
+	stopping := make(chan struct{})
+	h.ShutdownOn(stopping)
+	if report := h.Report(context.Background(), Readiness); report.Status != StatusOk {
+		t.Fatalf("expected ready, got %+v", report)
+	}
+
+	close(stopping)
+	time.Sleep(10 * time.Millisecond)
+	code, report := get(t, h.Readyz(), "/readyz")
+	if code != http.StatusServiceUnavailable || report.Shutdown == nil || report.Shutdown.Status != StatusFail {
+		t.Fatalf("expected unready, got %d %+v", code, report)
+	}
+
+	code, report = get(t, h.Livez(), "/livez")
+	if code != http.StatusServiceUnavailable || report.Checks["broken"].Error != "broken" {
+		t.Fatalf("expected failing liveness, got %d %+v", code, report)
+	}
+}
+
+func TestReservedNames(t *testing.T) {
+	mon := workers.NewMonitor()
+	mon.Push("smtp", false)
+	h := New(mon)
+	h.AddCheck("smtp", func(ctx context.Context) error { return nil }, CheckOptions{})
+	h.AddCheck("shutdown", func(ctx context.Context) error { return nil }, CheckOptions{})
+	h.Shutdown()
+
+	report := h.Report(context.Background(), Readiness)
+	if report.Checks["smtp"].Status != StatusOk || report.Monitor["smtp"].Status != StatusFail {
+		t.Fatalf("check and monitor status of the same name have collided %+v", report)
+	}
+	if report.Checks["shutdown"].Status != StatusOk || report.Shutdown == nil || report.Shutdown.Status != StatusFail {
+		t.Fatalf("check named shutdown has collided with the shutdown %+v", report)
+	}
+	if report.Status != StatusFail {
+		t.Fatalf("expected failing report, got %s", report.Status)
+	}
+}
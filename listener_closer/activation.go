@@ -0,0 +1,87 @@
+package listener_closer
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// first file descriptor passed by systemd socket activation, see sd_listen_fds(3)
+const listenFdsStart = 3
+
+// returns files passed by systemd socket activation from LISTEN_FDS, in order they are declared in the socket unit,
+// along with their names from LISTEN_FDNAMES. returns nothing if the sockets were passed to other process.
+// the environment variables are unset so child processes do not inherit them.
+func ActivationFiles() ([]*os.File, []string, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, nil, errors.New("invalid LISTEN_FDS value " + os.Getenv("LISTEN_FDS"))
+	}
+
+	var names []string
+	if v := os.Getenv("LISTEN_FDNAMES"); v != "" {
+		names = strings.Split(v, ":")
+	}
+
+	files := make([]*os.File, 0, n)
+	fdNames := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		files = append(files, os.NewFile(uintptr(listenFdsStart+i), name))
+		fdNames = append(fdNames, name)
+	}
+	return files, fdNames, nil
+}
+
+// returns listeners, wrapped by Wrap(), for sockets passed by systemd socket activation.
+// files which are not stream sockets, ie. datagram sockets, are skipped and closed.
+func Activated() ([]net.Listener, error) {
+	named, err := ActivatedByName()
+	if err != nil {
+		return nil, err
+	}
+	var out []net.Listener
+	for _, v := range named {
+		out = append(out, v.Listener)
+	}
+	return out, nil
+}
+
+type NamedListener struct {
+	Name string
+	net.Listener
+}
+
+// same as Activated() but listeners carry their names from FileDescriptorName= of the socket unit
+func ActivatedByName() ([]NamedListener, error) {
+	files, names, err := ActivationFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []NamedListener
+	for k, f := range files {
+		// the file descriptor is duplicated by the listener so the original one is closed
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		out = append(out, NamedListener{Name: names[k], Listener: Wrap(l)})
+	}
+	return out, nil
+}
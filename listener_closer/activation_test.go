@@ -0,0 +1,80 @@
+//go:build !windows
+// +build !windows
+
+package listener_closer
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+)
+
+// the test runs itself in a child process which receives the socket as file descriptor 3
+func TestActivated(t *testing.T) {
+	if os.Getenv("TEST_ACTIVATION_CHILD") == "1" {
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		listeners, err := ActivatedByName()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(listeners) != 1 || listeners[0].Name != "http" {
+			t.Fatalf("unexpected listeners %v", listeners)
+		}
+		if os.Getenv("LISTEN_FDS") != "" {
+			t.Fatal("environment has not been unset")
+		}
+		conn, err := listeners[0].Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte("ok"))
+		conn.Close()
+		listeners[0].Close()
+		return
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestActivated$")
+	cmd.Env = append(os.Environ(), "TEST_ACTIVATION_CHILD=1", "LISTEN_FDS=1", "LISTEN_FDNAMES=http")
+	cmd.ExtraFiles = []*os.File{f}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "ok" {
+		t.Fatalf("unexpected response %q %v", buf, err)
+	}
+	conn.Close()
+
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotActivated(t *testing.T) {
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "1")
+	listeners, err := Activated()
+	if err != nil || len(listeners) != 0 {
+		t.Fatalf("expected no listeners for other process, got %v %v", listeners, err)
+	}
+}
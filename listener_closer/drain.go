@@ -0,0 +1,292 @@
+package listener_closer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// returned by Accept() once the listener is closed, it wraps net.ErrClosed
+var ErrListenerClosed = fmt.Errorf("listener closed: %w", net.ErrClosed)
+
+var errTooManyConns = errors.New("too many connections from the address")
+
+type DrainOptions struct {
+	// Accept() waits for a free slot once there are this many connections, zero means no limit
+	MaxConns int
+	// connections over this number from one IP address are closed right after they are accepted, zero means no limit.
+	// connections from ProxyListener are counted by the client's address once the PROXY header has been read,
+	// on their first Read(), Write(), RemoteAddr() or LocalAddr() call, and rejected connection returns an error from it.
+	MaxConnsPerIP int
+	// called with each connection rejected by MaxConnsPerIP, before it is closed
+	OnReject func(conn net.Conn)
+}
+
+// DrainingListener tracks accepted connections so that they can be drained on shutdown.
+type DrainingListener struct {
+	net.Listener
+	opts  DrainOptions
+	slots chan struct{}
+	mx    sync.Mutex
+	conns map[*trackedConn]struct{}
+	perIP map[string]int
+	// closed once the listener is closed
+	done chan struct{}
+	// closed and replaced once there is no connection
+	idle   chan struct{}
+	once   sync.Once
+	closeE error
+}
+
+func NewDrainingListener(l net.Listener, opts DrainOptions) *DrainingListener {
+	d := &DrainingListener{
+		Listener: l,
+		opts:     opts,
+		conns:    make(map[*trackedConn]struct{}),
+		perIP:    make(map[string]int),
+		done:     make(chan struct{}),
+		idle:     make(chan struct{}),
+	}
+	close(d.idle)
+	if opts.MaxConns > 0 {
+		d.slots = make(chan struct{}, opts.MaxConns)
+	}
+	return d
+}
+
+func (d *DrainingListener) Accept() (net.Conn, error) {
+	for {
+		if d.slots != nil {
+			select {
+			case d.slots <- struct{}{}:
+			case <-d.done:
+				return nil, ErrListenerClosed
+			}
+		}
+
+		conn, err := d.Listener.Accept()
+		if err != nil {
+			d.release()
+			select {
+			case <-d.done:
+				return nil, ErrListenerClosed
+			default:
+				return nil, err
+			}
+		}
+
+		tc, err := d.track(conn)
+		if err == nil {
+			return tc, nil
+		}
+
+		d.release()
+		// the connection has been accepted while the listener was closing
+		if err == ErrListenerClosed {
+			conn.Close()
+			return nil, err
+		}
+		if d.opts.OnReject != nil {
+			d.opts.OnReject(conn)
+		}
+		conn.Close()
+	}
+}
+
+func (d *DrainingListener) release() {
+	if d.slots != nil {
+		<-d.slots
+	}
+}
+
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// fails if the connection is over the per IP limit or if the listener is closed.
+// the latter is checked under the same lock as Drain() takes the connections so none is missed.
+// address of ProxyConn is known only once its header has been read, which would block Accept(),
+// so such connection is counted later by checkIP().
+func (d *DrainingListener) track(conn net.Conn) (*trackedConn, error) {
+	tc := &trackedConn{Conn: conn, l: d}
+	_, deferred := conn.(*ProxyConn)
+	if deferred == false {
+		tc.ip = remoteIP(conn)
+		tc.checked.Do(func() {})
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	select {
+	case <-d.done:
+		return nil, ErrListenerClosed
+	default:
+	}
+	if deferred == false {
+		if err := d.countIP(tc); err != nil {
+			return nil, err
+		}
+	}
+	if len(d.conns) == 0 {
+		d.idle = make(chan struct{})
+	}
+	d.conns[tc] = struct{}{}
+	return tc, nil
+}
+
+// must be called under the lock
+func (d *DrainingListener) countIP(tc *trackedConn) error {
+	if d.opts.MaxConnsPerIP > 0 && d.perIP[tc.ip] >= d.opts.MaxConnsPerIP {
+		return errTooManyConns
+	}
+	d.perIP[tc.ip]++
+	tc.counted = true
+	return nil
+}
+
+func (d *DrainingListener) untrack(tc *trackedConn) {
+	d.mx.Lock()
+	if _, ok := d.conns[tc]; ok {
+		delete(d.conns, tc)
+		if tc.counted {
+			if d.perIP[tc.ip]--; d.perIP[tc.ip] <= 0 {
+				delete(d.perIP, tc.ip)
+			}
+		}
+		if len(d.conns) == 0 {
+			close(d.idle)
+		}
+		d.release()
+	}
+	d.mx.Unlock()
+}
+
+// number of open connections
+func (d *DrainingListener) Active() int {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return len(d.conns)
+}
+
+// number of open connections from the IP address
+func (d *DrainingListener) ActiveFrom(ip string) int {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return d.perIP[ip]
+}
+
+// stops accepting new connections, the open ones are not affected
+func (d *DrainingListener) Close() error {
+	d.once.Do(func() {
+		d.mx.Lock()
+		close(d.done)
+		d.mx.Unlock()
+		d.closeE = d.Listener.Close()
+	})
+	return d.closeE
+}
+
+// stops accepting new connections and waits for the open ones to be closed.
+// once the context is done, remaining connections are closed and context's error is returned.
+func (d *DrainingListener) Drain(ctx context.Context) error {
+	d.Close()
+
+	d.mx.Lock()
+	idle := d.idle
+	d.mx.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+	}
+
+	d.mx.Lock()
+	conns := make([]*trackedConn, 0, len(d.conns))
+	for tc := range d.conns {
+		conns = append(conns, tc)
+	}
+	d.mx.Unlock()
+
+	for _, tc := range conns {
+		tc.Close()
+	}
+	return ctx.Err()
+}
+
+type trackedConn struct {
+	net.Conn
+	l       *DrainingListener
+	ip      string
+	counted bool
+	checked sync.Once
+	checkE  error
+	once    sync.Once
+	e       error
+}
+
+// counts the connection, whose address was not known when it was accepted, by the client's address.
+// connection over the limit is rejected and closed.
+func (c *trackedConn) checkIP() error {
+	c.checked.Do(func() {
+		ip := remoteIP(c.Conn)
+
+		c.l.mx.Lock()
+		if _, ok := c.l.conns[c]; ok {
+			c.ip = ip
+			c.checkE = c.l.countIP(c)
+		}
+		c.l.mx.Unlock()
+
+		if c.checkE != nil {
+			if c.l.opts.OnReject != nil {
+				c.l.opts.OnReject(c.Conn)
+			}
+			c.Close()
+		}
+	})
+	return c.checkE
+}
+
+func (c *trackedConn) Read(b []byte) (int, error) {
+	if err := c.checkIP(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *trackedConn) Write(b []byte) (int, error) {
+	if err := c.checkIP(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *trackedConn) RemoteAddr() net.Addr {
+	c.checkIP()
+	return c.Conn.RemoteAddr()
+}
+
+func (c *trackedConn) LocalAddr() net.Addr {
+	c.checkIP()
+	return c.Conn.LocalAddr()
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.e = c.Conn.Close()
+		c.l.untrack(c)
+	})
+	return c.e
+}
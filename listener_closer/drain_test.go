@@ -0,0 +1,181 @@
+package listener_closer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func listen(t *testing.T, opts DrainOptions) *DrainingListener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDrainingListener(l, opts)
+}
+
+// accepts connections in the background and sends them to the channel
+func acceptAll(d *DrainingListener) <-chan net.Conn {
+	ch := make(chan net.Conn, 10)
+	go func() {
+		defer close(ch)
+		for {
+			conn, err := d.Accept()
+			if err != nil {
+				return
+			}
+			ch <- conn
+		}
+	}()
+	return ch
+}
+
+func dial(t *testing.T, d *DrainingListener) net.Conn {
+	conn, err := net.Dial("tcp", d.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestDrain(t *testing.T) {
+	d := listen(t, DrainOptions{})
+	accepted := acceptAll(d)
+
+	client := dial(t, d)
+	defer client.Close()
+	server := <-accepted
+	if d.Active() != 1 {
+		t.Fatalf("expected 1 connection, got %d", d.Active())
+	}
+
+	done := make(chan error)
+	go func() { done <- d.Drain(context.Background()) }()
+
+	if _, ok := <-accepted; ok {
+		t.Fatal("expected accepting to stop")
+	}
+	select {
+	case <-done:
+		t.Fatal("drain returned with open connection")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	server.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDrainForcesClose(t *testing.T) {
+	d := listen(t, DrainOptions{})
+	accepted := acceptAll(d)
+
+	client := dial(t, d)
+	defer client.Close()
+	<-accepted
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := d.Drain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline, got %v", err)
+	}
+	if d.Active() != 0 {
+		t.Fatal("expected connections to be closed")
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected closed connection")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	var rejected int
+	d := listen(t, DrainOptions{MaxConns: 3, MaxConnsPerIP: 2, OnReject: func(conn net.Conn) { rejected++ }})
+	defer d.Close()
+	accepted := acceptAll(d)
+
+	c1, c2, c3 := dial(t, d), dial(t, d), dial(t, d)
+	defer c1.Close()
+	defer c2.Close()
+	defer c3.Close()
+	s1 := <-accepted
+	<-accepted
+
+	// the third connection from the same address is rejected
+	c3.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c3.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected rejected connection")
+	}
+	if d.ActiveFrom("127.0.0.1") != 2 {
+		t.Fatalf("expected 2 connections, got %d", d.ActiveFrom("127.0.0.1"))
+	}
+
+	s1.Close()
+	c4 := dial(t, d)
+	defer c4.Close()
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("connection has not been accepted after the slot was freed")
+	}
+	if rejected != 1 {
+		t.Fatalf("expected 1 rejection, got %d", rejected)
+	}
+}
+
+// listener which returns connections sent to it, even after it has been closed
+type pipeListener struct {
+	conns chan net.Conn
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	return <-l.conns, nil
+}
+
+func (l *pipeListener) Close() error {
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+func TestAcceptAfterClose(t *testing.T) {
+	l := &pipeListener{conns: make(chan net.Conn)}
+	d := NewDrainingListener(l, DrainOptions{})
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		conn, err := d.Accept()
+		accepted <- result{conn, err}
+	}()
+
+	// the connection arrives while the listener is being drained
+	if err := d.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+	l.conns <- server
+
+	res := <-accepted
+	if res.conn != nil || errors.Is(res.err, net.ErrClosed) == false {
+		t.Fatalf("expected closed listener error, got %v", res.err)
+	}
+	if d.Active() != 0 {
+		t.Fatalf("expected no tracked connection, got %d", d.Active())
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected the connection to be closed, got %v", err)
+	}
+}
@@ -0,0 +1,386 @@
+package listener_closer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// returned by the connection from trusted upstream which did not send the PROXY protocol header
+	ErrNoProxyHeader = errors.New("missing proxy protocol header")
+	// returned by the connection which sent malformed PROXY protocol header
+	ErrInvalidProxyHeader = errors.New("invalid proxy protocol header")
+)
+
+// default time in which the upstream has to send the header
+const DefaultProxyHeaderTimeout = 5 * time.Second
+
+// types of PROXY protocol v2 TLVs
+const (
+	TLVTypeALPN      byte = 0x01
+	TLVTypeAuthority byte = 0x02
+	TLVTypeCRC32C    byte = 0x03
+	TLVTypeNoop      byte = 0x04
+	TLVTypeUniqueID  byte = 0x05
+	TLVTypeSSL       byte = 0x20
+	TLVTypeNetNS     byte = 0x30
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1 header is never longer than this, including the CRLF
+const proxyV1MaxLength = 107
+
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+type ProxyOptions struct {
+	// time in which the header has to be received, defaults to DefaultProxyHeaderTimeout
+	HeaderTimeout time.Duration
+	// connections from these networks are required to send the header, others are passed through
+	// with their own addresses. empty list means all connections are required to send it.
+	Trusted []*net.IPNet
+}
+
+// parses networks in CIDR notation, ie. "10.0.0.0/8"
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	out := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// ProxyListener accepts connections from proxies, like HAProxy, which send PROXY protocol v1 or v2 header.
+// the header is read on the first Read(), RemoteAddr() or LocalAddr() call of the connection
+// so slow upstream does not block Accept(). DrainingListener wrapping this listener limits
+// connections per address of the client once the header has been read.
+type ProxyListener struct {
+	net.Listener
+	opts ProxyOptions
+}
+
+func NewProxyListener(l net.Listener, opts ProxyOptions) *ProxyListener {
+	if opts.HeaderTimeout <= 0 {
+		opts.HeaderTimeout = DefaultProxyHeaderTimeout
+	}
+	return &ProxyListener{Listener: l, opts: opts}
+}
+
+func (p *ProxyListener) trusted(addr net.Addr) bool {
+	if len(p.opts.Trusted) == 0 {
+		return true
+	}
+	tcp, ok := addr.(*net.TCPAddr)
+	if ok == false {
+		return false
+	}
+	for _, n := range p.opts.Trusted {
+		if n.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ProxyListener) Accept() (net.Conn, error) {
+	conn, err := p.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	pc := &ProxyConn{Conn: conn, timeout: p.opts.HeaderTimeout}
+	if p.trusted(conn.RemoteAddr()) == false {
+		// untrusted connection is never parsed
+		pc.once.Do(func() {})
+	}
+	return pc, nil
+}
+
+// ProxyConn reports addresses from the PROXY protocol header
+type ProxyConn struct {
+	net.Conn
+	timeout time.Duration
+	once    sync.Once
+	// read deadline set by the user, it is restored once the header has been read
+	mx           sync.Mutex
+	reading      bool
+	readDeadline time.Time
+	br           *bufio.Reader
+	err          error
+	version      int
+	remote       net.Addr
+	local        net.Addr
+	tlvs         []TLV
+}
+
+func (c *ProxyConn) init() {
+	c.once.Do(func() {
+		c.br = bufio.NewReader(c.Conn)
+
+		c.mx.Lock()
+		c.reading = true
+		deadline := time.Now().Add(c.timeout)
+		if c.readDeadline.IsZero() == false && c.readDeadline.Before(deadline) {
+			deadline = c.readDeadline
+		}
+		c.Conn.SetReadDeadline(deadline)
+		c.mx.Unlock()
+
+		c.err = c.readHeader()
+
+		c.mx.Lock()
+		c.reading = false
+		c.Conn.SetReadDeadline(c.readDeadline)
+		c.mx.Unlock()
+	})
+}
+
+// deadline set while the header is being read is applied once it has been read
+func (c *ProxyConn) SetReadDeadline(t time.Time) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.readDeadline = t
+	if c.reading {
+		return nil
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *ProxyConn) SetDeadline(t time.Time) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.readDeadline = t
+	if c.reading {
+		return c.Conn.SetWriteDeadline(t)
+	}
+	return c.Conn.SetDeadline(t)
+}
+
+// returns the connection from the proxy. its addresses are available without reading the header.
+func (c *ProxyConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *ProxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.br == nil {
+		return c.Conn.Read(b)
+	}
+	return c.br.Read(b)
+}
+
+// address of the client as reported by the proxy, or of the connection if the proxy did not report it
+func (c *ProxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// address the client connected to as reported by the proxy, or of the connection if the proxy did not report it
+func (c *ProxyConn) LocalAddr() net.Addr {
+	c.init()
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+// version of the received header, zero if there is none
+func (c *ProxyConn) ProxyVersion() int {
+	c.init()
+	return c.version
+}
+
+// error of reading the header
+func (c *ProxyConn) ProxyError() error {
+	c.init()
+	return c.err
+}
+
+// TLVs of v2 header
+func (c *ProxyConn) TLVs() []TLV {
+	c.init()
+	return c.tlvs
+}
+
+// returns value of the first TLV of the type
+func (c *ProxyConn) TLV(typ byte) ([]byte, bool) {
+	for _, t := range c.TLVs() {
+		if t.Type == typ {
+			return t.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (c *ProxyConn) readHeader() error {
+	b, err := c.br.Peek(1)
+	if err != nil {
+		return err
+	}
+	switch b[0] {
+	case 'P':
+		return c.readV1()
+	case '\r':
+		return c.readV2()
+	default:
+		return ErrNoProxyHeader
+	}
+}
+
+func (c *ProxyConn) readV1() error {
+	var line []byte
+	for {
+		b, err := c.br.ReadByte()
+		if err != nil {
+			return err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLength {
+			return ErrInvalidProxyHeader
+		}
+	}
+	if bytes.HasSuffix(line, []byte("\r\n")) == false {
+		return ErrInvalidProxyHeader
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if fields[0] != "PROXY" || len(fields) < 2 {
+		return ErrInvalidProxyHeader
+	}
+	c.version = 1
+
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil
+	case "TCP4", "TCP6":
+	default:
+		return ErrInvalidProxyHeader
+	}
+	if len(fields) != 6 {
+		return ErrInvalidProxyHeader
+	}
+
+	src, dst := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	sport, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dport, err2 := strconv.ParseUint(fields[5], 10, 16)
+	if src == nil || dst == nil || err1 != nil || err2 != nil {
+		return ErrInvalidProxyHeader
+	}
+	if (fields[1] == "TCP4") != (src.To4() != nil && dst.To4() != nil) {
+		return ErrInvalidProxyHeader
+	}
+
+	c.remote = &net.TCPAddr{IP: src, Port: int(sport)}
+	c.local = &net.TCPAddr{IP: dst, Port: int(dport)}
+	return nil
+}
+
+func (c *ProxyConn) readV2() error {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(c.br, header); err != nil {
+		return err
+	}
+	if bytes.Equal(header[:12], proxyV2Signature) == false || header[12]>>4 != 2 {
+		return ErrInvalidProxyHeader
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return err
+	}
+	c.version = 2
+
+	switch header[12] & 0x0f {
+	case 0x00:
+		// LOCAL command, ie. health check of the proxy itself, keeps the connection's addresses
+		return nil
+	case 0x01:
+	default:
+		return ErrInvalidProxyHeader
+	}
+
+	family, transport := header[13]>>4, header[13]&0x0f
+	var addrLen int
+	switch family {
+	case 0x00:
+		addrLen = 0
+	case 0x01:
+		addrLen = 12
+	case 0x02:
+		addrLen = 36
+	case 0x03:
+		addrLen = 216
+	default:
+		return ErrInvalidProxyHeader
+	}
+	if len(payload) < addrLen {
+		return ErrInvalidProxyHeader
+	}
+
+	addr := payload[:addrLen]
+	switch family {
+	case 0x01, 0x02:
+		n := (addrLen - 4) / 2
+		src, dst := net.IP(addr[:n]), net.IP(addr[n:2*n])
+		sport := int(binary.BigEndian.Uint16(addr[2*n:]))
+		dport := int(binary.BigEndian.Uint16(addr[2*n+2:]))
+		if transport == 0x02 {
+			c.remote = &net.UDPAddr{IP: src, Port: sport}
+			c.local = &net.UDPAddr{IP: dst, Port: dport}
+		} else {
+			c.remote = &net.TCPAddr{IP: src, Port: sport}
+			c.local = &net.TCPAddr{IP: dst, Port: dport}
+		}
+	case 0x03:
+		c.remote = &net.UnixAddr{Name: string(bytes.TrimRight(addr[:108], "\x00")), Net: "unix"}
+		c.local = &net.UnixAddr{Name: string(bytes.TrimRight(addr[108:], "\x00")), Net: "unix"}
+	}
+
+	tlvs, err := parseTLVs(payload[addrLen:])
+	if err != nil {
+		return err
+	}
+	c.tlvs = tlvs
+	return nil
+}
+
+func parseTLVs(b []byte) ([]TLV, error) {
+	var out []TLV
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return nil, ErrInvalidProxyHeader
+		}
+		n := int(binary.BigEndian.Uint16(b[1:3]))
+		if len(b) < 3+n {
+			return nil, ErrInvalidProxyHeader
+		}
+		if b[0] != TLVTypeNoop {
+			out = append(out, TLV{Type: b[0], Value: b[3 : 3+n]})
+		}
+		b = b[3+n:]
+	}
+	return out, nil
+}
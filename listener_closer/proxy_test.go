@@ -0,0 +1,236 @@
+package listener_closer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func proxyPair(t *testing.T, opts ProxyOptions, header []byte) (*ProxyConn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProxyListener(l, opts)
+	t.Cleanup(func() { p.Close() })
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	client.Write(header)
+	client.Write([]byte("hello"))
+
+	conn, err := p.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn.(*ProxyConn), client
+}
+
+func expectHello(t *testing.T, conn net.Conn) {
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("unexpected payload %q %v", buf, err)
+	}
+}
+
+func TestProxyV1(t *testing.T) {
+	conn, _ := proxyPair(t, ProxyOptions{}, []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 700\r\n"))
+
+	if addr := conn.RemoteAddr().String(); addr != "192.0.2.1:56324" {
+		t.Fatalf("unexpected remote address %s", addr)
+	}
+	if addr := conn.LocalAddr().String(); addr != "198.51.100.1:700" {
+		t.Fatalf("unexpected local address %s", addr)
+	}
+	if conn.ProxyVersion() != 1 {
+		t.Fatal("expected v1")
+	}
+	expectHello(t, conn)
+}
+
+func proxyV2Header(cmd byte, src, dst net.IP, sport, dport uint16, tlvs ...TLV) []byte {
+	var payload bytes.Buffer
+	payload.Write(src.To16())
+	payload.Write(dst.To16())
+	binary.Write(&payload, binary.BigEndian, sport)
+	binary.Write(&payload, binary.BigEndian, dport)
+	for _, tlv := range tlvs {
+		payload.WriteByte(tlv.Type)
+		binary.Write(&payload, binary.BigEndian, uint16(len(tlv.Value)))
+		payload.Write(tlv.Value)
+	}
+
+	var h bytes.Buffer
+	h.Write(proxyV2Signature)
+	h.WriteByte(0x20 | cmd)
+	h.WriteByte(0x21) // TCP over IPv6
+	binary.Write(&h, binary.BigEndian, uint16(payload.Len()))
+	h.Write(payload.Bytes())
+	return h.Bytes()
+}
+
+func TestProxyV2(t *testing.T) {
+	header := proxyV2Header(0x01, net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 4000, 443,
+		TLV{Type: TLVTypeNoop, Value: []byte{0}},
+		TLV{Type: TLVTypeAuthority, Value: []byte("epp.example.com")},
+	)
+	conn, _ := proxyPair(t, ProxyOptions{}, header)
+
+	if addr := conn.RemoteAddr().String(); addr != "[2001:db8::1]:4000" {
+		t.Fatalf("unexpected remote address %s", addr)
+	}
+	if v, ok := conn.TLV(TLVTypeAuthority); ok == false || string(v) != "epp.example.com" {
+		t.Fatalf("unexpected authority %q", v)
+	}
+	if len(conn.TLVs()) != 1 {
+		t.Fatal("noop TLV must be skipped")
+	}
+	expectHello(t, conn)
+}
+
+func TestProxyV2Local(t *testing.T) {
+	header := proxyV2Header(0x00, net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 4000, 443)
+	conn, client := proxyPair(t, ProxyOptions{}, header)
+
+	if conn.RemoteAddr().String() != client.LocalAddr().String() {
+		t.Fatalf("local command must keep the connection's address, got %s", conn.RemoteAddr())
+	}
+	expectHello(t, conn)
+}
+
+func TestProxyUntrusted(t *testing.T) {
+	trusted, err := ParseCIDRs("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, client := proxyPair(t, ProxyOptions{Trusted: trusted}, nil)
+
+	if conn.RemoteAddr().String() != client.LocalAddr().String() || conn.ProxyVersion() != 0 {
+		t.Fatal("untrusted connection must not be parsed")
+	}
+	expectHello(t, conn)
+}
+
+func TestProxyErrors(t *testing.T) {
+	conn, _ := proxyPair(t, ProxyOptions{}, nil)
+	if _, err := conn.Read(make([]byte, 1)); err != ErrNoProxyHeader {
+		t.Fatalf("expected missing header, got %v", err)
+	}
+
+	conn, _ = proxyPair(t, ProxyOptions{}, []byte("PROXY TCP4 192.0.2.1 2001:db8::1 1 2\r\n"))
+	if conn.ProxyError() != ErrInvalidProxyHeader {
+		t.Fatalf("expected invalid header, got %v", conn.ProxyError())
+	}
+}
+
+func TestProxyTimeout(t *testing.T) {
+	conn, _ := proxyPair(t, ProxyOptions{HeaderTimeout: 20 * time.Millisecond}, []byte("PROXY TCP4"))
+	start := time.Now()
+	if conn.ProxyError() == nil || time.Since(start) > time.Second {
+		t.Fatal("expected header timeout")
+	}
+}
+
+func TestProxyKeepsReadDeadline(t *testing.T) {
+	conn, _ := proxyPair(t, ProxyOptions{}, []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 700\r\n"))
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	expectHello(t, conn)
+
+	// the deadline set before the header was read still applies
+	start := time.Now()
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected deadline error")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("deadline has been reset by reading the header")
+	}
+}
+
+func TestDrainingProxyDoesNotBlockAccept(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDrainingListener(NewProxyListener(l, ProxyOptions{HeaderTimeout: 5 * time.Second}), DrainOptions{MaxConnsPerIP: 10})
+	defer d.Close()
+
+	// the upstream does not send the header yet
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := d.Accept()
+		accepted <- conn
+	}()
+	select {
+	case conn := <-accepted:
+		defer conn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("accept is blocked by reading the header")
+	}
+	if d.Active() != 1 || d.ActiveFrom("127.0.0.1") != 0 {
+		t.Fatal("expected connection tracked without the proxy's address")
+	}
+}
+
+func TestDrainingProxyLimitsPerClient(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rejected []string
+	d := NewDrainingListener(NewProxyListener(l, ProxyOptions{}), DrainOptions{
+		MaxConnsPerIP: 1,
+		OnReject: func(conn net.Conn) {
+			rejected = append(rejected, conn.RemoteAddr().String())
+		},
+	})
+	defer d.Close()
+
+	// all the connections come from the same proxy
+	read := func(client string) error {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.Write([]byte("PROXY TCP4 " + client + " 127.0.0.1 5000 80\r\nhello"))
+
+		server, err := d.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { server.Close() })
+		_, err = io.ReadFull(server, make([]byte, 5))
+		return err
+	}
+
+	if err := read("10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := read("10.0.0.2"); err != nil {
+		t.Fatalf("other client behind the same proxy has been rejected: %v", err)
+	}
+	if err := read("10.0.0.1"); err == nil {
+		t.Fatal("expected second connection of the client to be rejected")
+	}
+
+	if d.ActiveFrom("10.0.0.1") != 1 || d.ActiveFrom("10.0.0.2") != 1 || d.ActiveFrom("127.0.0.1") != 0 {
+		t.Fatalf("unexpected connections per address %d %d %d",
+			d.ActiveFrom("10.0.0.1"), d.ActiveFrom("10.0.0.2"), d.ActiveFrom("127.0.0.1"))
+	}
+	if d.Active() != 2 || len(rejected) != 1 || rejected[0] != "10.0.0.1:5000" {
+		t.Fatalf("unexpected rejections %v of %d connections", rejected, d.Active())
+	}
+}
@@ -2,15 +2,16 @@ package logrotator
 
 import (
 	"bytes"
+	"errors"
 	"github.com/ivanjaros/ijlibs/files"
 	"io"
 	"log"
 	"os"
-	"os/signal"
 	"sync"
-	"syscall"
 )
 
+// the log file is not reopened on SIGHUP by itself, Reopen() should be registered as
+// the application's reload hook, ie. app.OnReload(rotator.Reopen).
 func New(filePath string) (r *LogFileRotator, e error) {
 	r = &LogFileRotator{
 		path:    filePath,
@@ -18,15 +19,13 @@ func New(filePath string) (r *LogFileRotator, e error) {
 		buff:    new(bytes.Buffer),
 		ingress: make(chan []byte),
 		rotate:  make(chan string),
+		reopen:  make(chan chan error),
 	}
 
 	e = r.open()
 
 	if e == nil {
 		go func() {
-			sigChan := make(chan os.Signal, 1)
-			signal.Notify(sigChan, syscall.SIGHUP)
-
 			for {
 				select {
 				case <-r.closeCh:
@@ -41,14 +40,8 @@ func New(filePath string) (r *LogFileRotator, e error) {
 						}
 					}
 
-				case <-sigChan:
-					if err := r.close(); err != nil {
-						log.Println("error closing log file: ", err)
-					} else {
-						if err := r.open(); err != nil {
-							log.Println("error opening log file: ", err)
-						}
-					}
+				case res := <-r.reopen:
+					res <- r.open()
 
 				case rotate := <-r.rotate:
 					r.doRotate(rotate)
@@ -67,6 +60,7 @@ type LogFileRotator struct {
 	buff     *bytes.Buffer
 	ingress  chan []byte
 	rotate   chan string
+	reopen   chan chan error
 	closer   sync.Once
 	closeErr error
 }
@@ -122,6 +116,17 @@ func (r *LogFileRotator) Write(p []byte) (n int, err error) {
 	return 0, nil
 }
 
+// closes and opens the log file again, ie. after it has been moved by external log rotation.
+func (r *LogFileRotator) Reopen() error {
+	res := make(chan error, 1)
+	select {
+	case <-r.closeCh:
+		return errors.New("log file rotator is closed")
+	case r.reopen <- res:
+		return <-res
+	}
+}
+
 // calling this will cause the existing log file to be copied into the fileName and truncated to 0.
 func (r *LogFileRotator) Rotate(fileName string) {
 	r.rotate <- fileName
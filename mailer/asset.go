@@ -0,0 +1,78 @@
+package mailer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// MemoryAsset holds its data in memory so it can be read any number of times.
+// it can be encoded as json so the e-mail can be stored, ie. in a queue.
+type MemoryAsset struct {
+	Name string `json:"name"`
+	Mime string `json:"mime"`
+	Body []byte `json:"data"`
+}
+
+func NewAsset(name, mimeType string, data []byte) *MemoryAsset {
+	return &MemoryAsset{Name: name, Mime: mimeType, Body: data}
+}
+
+func (a *MemoryAsset) FileName() string {
+	return a.Name
+}
+
+func (a *MemoryAsset) MimeType() string {
+	return a.Mime
+}
+
+func (a *MemoryAsset) Data() io.ReadCloser {
+	return ioutil.NopCloser(bytes.NewReader(a.Body))
+}
+
+// reads the whole body, ie. of the envelope, returns nil if there is no body or if it is empty.
+// the reader is not closed, that is done by Envelope.Close().
+func ReadBody(r io.ReadCloser) ([]byte, error) {
+	if r == nil {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	return data, nil
+}
+
+// reads the assets into memory, returns nil if there are none
+func ReadAssets(in []Asset) ([]*MemoryAsset, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	out := make([]*MemoryAsset, len(in))
+	for k, a := range in {
+		data, err := readAsset(a)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = NewAsset(a.FileName(), a.MimeType(), data)
+	}
+	return out, nil
+}
+
+func readAsset(a Asset) ([]byte, error) {
+	r := a.Data()
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// converts the memory assets into the interface
+func Assets(in []*MemoryAsset) []Asset {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make([]Asset, len(in))
+	for k := range in {
+		out[k] = in[k]
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type closeCounter struct {
+	io.Reader
+	closed *int
+}
+
+func (c closeCounter) Close() error {
+	*c.closed++
+	return nil
+}
+
+type testAsset struct {
+	data   string
+	closed int
+}
+
+func (a *testAsset) FileName() string {
+	return "file.txt"
+}
+
+func (a *testAsset) MimeType() string {
+	return "text/plain"
+}
+
+func (a *testAsset) Data() io.ReadCloser {
+	return closeCounter{Reader: bytes.NewReader([]byte(a.data)), closed: &a.closed}
+}
+
+func TestReadAssets(t *testing.T) {
+	in := []Asset{&testAsset{data: "a"}, &testAsset{data: "b"}}
+	out, err := ReadAssets(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || string(out[0].Body) != "a" || string(out[1].Body) != "b" || out[0].Name != "file.txt" {
+		t.Fatalf("unexpected assets %+v", out)
+	}
+	for k := range in {
+		if n := in[k].(*testAsset).closed; n != 1 {
+			t.Errorf("asset %d closed %d times", k, n)
+		}
+	}
+}
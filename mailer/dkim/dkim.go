@@ -0,0 +1,344 @@
+// Package dkim signs and verifies e-mails according to RFC 6376, using relaxed or simple canonicalization
+// and either rsa-sha256 or ed25519-sha256(RFC 8463) algorithm.
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AlgorithmRSA     = "rsa-sha256"
+	AlgorithmEd25519 = "ed25519-sha256"
+
+	signatureHeader = "DKIM-Signature"
+	// length of the folded lines of the signature
+	foldLength = 72
+)
+
+// headers signed when no other are specified
+var DefaultHeaders = []string{
+	"From", "Sender", "Reply-To", "Subject", "Date", "Message-Id", "To", "Cc",
+	"Mime-Version", "Content-Type", "Content-Transfer-Encoding",
+	"In-Reply-To", "References", "List-Id", "List-Unsubscribe",
+}
+
+var ErrUnsupportedKey = errors.New("unsupported dkim key, only rsa and ed25519 keys are supported")
+
+type Key struct {
+	// signing domain(d=)
+	Domain string
+	// selector(s=), the public key is published as TXT record at <selector>._domainkey.<domain>
+	Selector string
+	// *rsa.PrivateKey or ed25519.PrivateKey
+	Signer crypto.Signer
+}
+
+type SignOptions struct {
+	// headers to sign, defaults to DefaultHeaders. headers missing in the message are not signed.
+	Headers []string
+	// adds signature expiration(x=) if set
+	Expiration time.Duration
+	// signature timestamp(t=), defaults to current time
+	Time time.Time
+	// header and body canonicalization(c=), ie. "simple/relaxed", defaults to "relaxed/relaxed"
+	Canonicalization string
+}
+
+// Signs the message and returns it with DKIM-Signature header prepended.
+func Sign(message []byte, key Key, opts SignOptions) ([]byte, error) {
+	algorithm, err := keyAlgorithm(key.Signer)
+	if err != nil {
+		return nil, err
+	}
+	if key.Domain == "" || key.Selector == "" {
+		return nil, errors.New("dkim key has no domain or selector")
+	}
+	c := opts.Canonicalization
+	if c == "" {
+		c = "relaxed/relaxed"
+	}
+	headerCanon, bodyCanon, err := parseCanonicalization(c)
+	if err != nil {
+		return nil, err
+	}
+
+	message = normalizeNewlines(message)
+	headers, body := splitMessage(message)
+
+	names := opts.Headers
+	if len(names) == 0 {
+		names = DefaultHeaders
+	}
+	signed := selectHeaders(headers, names)
+
+	now := opts.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	bodyHash := sha256.Sum256(canonicalBody(body, bodyCanon))
+
+	tags := []string{
+		"v=1",
+		"a=" + algorithm,
+		"c=" + headerCanon + "/" + bodyCanon,
+		"d=" + key.Domain,
+		"s=" + key.Selector,
+		"t=" + strconv.FormatInt(now.Unix(), 10),
+	}
+	if opts.Expiration > 0 {
+		tags = append(tags, "x="+strconv.FormatInt(now.Add(opts.Expiration).Unix(), 10))
+	}
+	signedNames := make([]string, len(signed))
+	for k, h := range signed {
+		signedNames[k] = strings.ToLower(h.name)
+	}
+	tags = append(tags,
+		"h="+strings.Join(signedNames, ":"),
+		"bh="+base64.StdEncoding.EncodeToString(bodyHash[:]),
+	)
+	// the signature is long enough to always start on its own line
+	field := foldTags(signatureHeader+": ", tags) + ";\r\n\tb="
+
+	hash := headerHash(signed, field, headerCanon)
+	var sig []byte
+	if algorithm == AlgorithmRSA {
+		sig, err = key.Signer.Sign(rand.Reader, hash, crypto.SHA256)
+	} else {
+		sig, err = key.Signer.Sign(rand.Reader, hash, crypto.Hash(0))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(field)+len(message)+512))
+	out.WriteString(field)
+	out.WriteString(fold(base64.StdEncoding.EncodeToString(sig)))
+	out.WriteString("\r\n")
+	out.Write(message)
+	return out.Bytes(), nil
+}
+
+func keyAlgorithm(signer crypto.Signer) (string, error) {
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		return AlgorithmRSA, nil
+	case ed25519.PrivateKey, *ed25519.PrivateKey:
+		return AlgorithmEd25519, nil
+	}
+	if signer != nil {
+		switch signer.Public().(type) {
+		case *rsa.PublicKey:
+			return AlgorithmRSA, nil
+		case ed25519.PublicKey:
+			return AlgorithmEd25519, nil
+		}
+	}
+	return "", ErrUnsupportedKey
+}
+
+// hash of the canonicalized signed headers followed by the signature header without its trailing new line
+func headerHash(signed []header, signature string, canon string) []byte {
+	h := sha256.New()
+	for _, hdr := range signed {
+		h.Write([]byte(canonicalHeader(hdr.raw, canon)))
+		h.Write([]byte("\r\n"))
+	}
+	h.Write([]byte(canonicalHeader(signature, canon)))
+	return h.Sum(nil)
+}
+
+// splits c= tag into header and body canonicalization, missing ones are simple
+func parseCanonicalization(c string) (string, string, error) {
+	headerCanon, bodyCanon := "simple", "simple"
+	if c != "" {
+		parts := strings.SplitN(c, "/", 2)
+		headerCanon = parts[0]
+		if len(parts) == 2 {
+			bodyCanon = parts[1]
+		}
+	}
+	for _, v := range []string{headerCanon, bodyCanon} {
+		if v != "simple" && v != "relaxed" {
+			return "", "", errors.New("unsupported dkim canonicalization: " + c)
+		}
+	}
+	return headerCanon, bodyCanon, nil
+}
+
+func canonicalHeader(raw string, canon string) string {
+	if canon == "relaxed" {
+		return relaxedHeader(raw)
+	}
+	return raw
+}
+
+func canonicalBody(body []byte, canon string) []byte {
+	if canon == "relaxed" {
+		return relaxedBody(body)
+	}
+	return simpleBody(body)
+}
+
+func fold(value string) string {
+	var sb strings.Builder
+	for len(value) > foldLength {
+		sb.WriteString(value[:foldLength])
+		sb.WriteString("\r\n\t")
+		value = value[foldLength:]
+	}
+	sb.WriteString(value)
+	return sb.String()
+}
+
+// joins the tags and breaks the lines before they get too long
+func foldTags(prefix string, tags []string) string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	line := len(prefix)
+	for k, tag := range tags {
+		if k > 0 {
+			if line+len(tag)+2 > foldLength {
+				sb.WriteString(";\r\n\t")
+				line = 1
+			} else {
+				sb.WriteString("; ")
+				line += 2
+			}
+		}
+		sb.WriteString(tag)
+		line += len(tag)
+	}
+	return sb.String()
+}
+
+type header struct {
+	name string
+	// whole header including the name and folding, without the trailing new line
+	raw string
+}
+
+func normalizeNewlines(message []byte) []byte {
+	if bytes.Contains(message, []byte("\r\n")) && bytes.Count(message, []byte("\n")) == bytes.Count(message, []byte("\r\n")) {
+		return message
+	}
+	message = bytes.ReplaceAll(message, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(message, []byte("\n"), []byte("\r\n"))
+}
+
+func splitMessage(message []byte) ([]header, []byte) {
+	var headers []header
+	var body []byte
+
+	rest := string(message)
+	for len(rest) > 0 {
+		end := strings.Index(rest, "\r\n")
+		if end == -1 {
+			end = len(rest)
+		}
+		line := rest[:end]
+		rest = rest[minInt(end+2, len(rest)):]
+
+		if line == "" {
+			body = []byte(rest)
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1].raw += "\r\n" + line
+			continue
+		}
+		name := line
+		if colon := strings.IndexByte(line, ':'); colon > -1 {
+			name = line[:colon]
+		}
+		headers = append(headers, header{name: strings.TrimSpace(name), raw: line})
+	}
+
+	return headers, body
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// picks the headers to sign, multiple instances of the same header are taken from the bottom up
+func selectHeaders(headers []header, names []string) []header {
+	used := make(map[int]bool)
+	out := make([]header, 0, len(names))
+	for _, name := range names {
+		for i := len(headers) - 1; i >= 0; i-- {
+			if used[i] == false && strings.EqualFold(headers[i].name, name) {
+				used[i] = true
+				out = append(out, headers[i])
+				break
+			}
+		}
+	}
+	return out
+}
+
+// relaxed header canonicalization, RFC 6376 section 3.4.2
+func relaxedHeader(raw string) string {
+	name, value := raw, ""
+	if colon := strings.IndexByte(raw, ':'); colon > -1 {
+		name, value = raw[:colon], raw[colon+1:]
+	}
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(compactSpace(value))
+}
+
+// relaxed body canonicalization, RFC 6376 section 3.4.4
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for k := range lines {
+		lines[k] = strings.TrimRight(compactSpace(lines[k]), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// simple body canonicalization, RFC 6376 section 3.4.3
+func simpleBody(body []byte) []byte {
+	for bytes.HasSuffix(body, []byte("\r\n")) {
+		body = body[:len(body)-2]
+	}
+	return append(body, '\r', '\n')
+}
+
+func compactSpace(s string) string {
+	var sb strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			sb.WriteByte(' ')
+			space = false
+		}
+		sb.WriteByte(s[i])
+	}
+	if space {
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
@@ -0,0 +1,146 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/ivanjaros/ijlibs/mailer"
+	"net/mail"
+	"testing"
+)
+
+func testKeys(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]crypto.Signer{AlgorithmRSA: rsaKey, AlgorithmEd25519: edKey}
+}
+
+// publishes the public key as TXT record and parses it back, like LookupDNS would
+func testLookup(t *testing.T, signer crypto.Signer) KeyLookup {
+	t.Helper()
+	record, err := Record(signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(domain, selector string) (crypto.PublicKey, error) {
+		if domain != "example.com" || selector != "mail" {
+			t.Errorf("unexpected key lookup %s %s", domain, selector)
+		}
+		return ParseRecord(record)
+	}
+}
+
+func testMessage(t *testing.T) []byte {
+	t.Helper()
+	msg := new(mailer.Message)
+	msg.SetFrom(mail.Address{Name: "Sender", Address: "noreply@example.com"})
+	msg.SetTo([]mail.Address{{Name: "John", Address: "john@example.com"}})
+	msg.SetSubject("hello world")
+	msg.SetBody([]byte("plain body\n\n"))
+	msg.SetHtml([]byte("<p>html body</p>"))
+
+	buff := bytes.NewBuffer(nil)
+	if _, err := mailer.Render(buff, msg, mailer.RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return buff.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	message := testMessage(t)
+
+	for algorithm, signer := range testKeys(t) {
+		lookup := testLookup(t, signer)
+		key := Key{Domain: "example.com", Selector: "mail", Signer: signer}
+
+		for _, c := range []string{"", "relaxed/relaxed", "simple/simple", "relaxed/simple", "simple/relaxed"} {
+			signed, err := Sign(message, key, SignOptions{Canonicalization: c})
+			if err != nil {
+				t.Fatalf("%s %s: %v", algorithm, c, err)
+			}
+			if bytes.HasSuffix(signed, message) == false {
+				t.Fatalf("%s %s: signature is not prepended to the message", algorithm, c)
+			}
+
+			results, err := Verify(signed, lookup)
+			if err != nil {
+				t.Fatalf("%s %s: %v", algorithm, c, err)
+			}
+			if len(results) != 1 || results[0].Err != nil {
+				t.Fatalf("%s %s: unexpected verification %+v", algorithm, c, results)
+			}
+			if v := results[0]; v.Domain != "example.com" || v.Selector != "mail" || len(v.Headers) == 0 {
+				t.Fatalf("%s %s: unexpected verification %+v", algorithm, c, v)
+			}
+
+			tampered := bytes.Replace(signed, []byte("hello world"), []byte("hello there"), 1)
+			if results, _ := Verify(tampered, lookup); results[0].Err != ErrInvalidSig {
+				t.Errorf("%s %s: expected invalid signature of changed subject, got %v", algorithm, c, results[0].Err)
+			}
+			tampered = bytes.Replace(signed, []byte("html body"), []byte("html text"), 1)
+			if results, _ := Verify(tampered, lookup); results[0].Err != ErrInvalidBodyHash {
+				t.Errorf("%s %s: expected invalid body hash of changed body, got %v", algorithm, c, results[0].Err)
+			}
+		}
+	}
+}
+
+// relaxed canonicalization survives changes of whitespace made by relays, simple does not
+func TestCanonicalization(t *testing.T) {
+	message := testMessage(t)
+	signer := testKeys(t)[AlgorithmEd25519]
+	lookup := testLookup(t, signer)
+	key := Key{Domain: "example.com", Selector: "mail", Signer: signer}
+
+	cases := []struct {
+		canon   string
+		change  func(signed []byte) []byte
+		expect  error
+		comment string
+	}{
+		{"relaxed/relaxed", spaceInHeader, nil, "header whitespace"},
+		{"simple/simple", spaceInHeader, ErrInvalidSig, "header whitespace"},
+		{"relaxed/relaxed", spaceInBody, nil, "body whitespace"},
+		{"simple/simple", spaceInBody, ErrInvalidBodyHash, "body whitespace"},
+		{"simple/simple", trailingLines, nil, "trailing empty lines"},
+	}
+
+	for _, c := range cases {
+		signed, err := Sign(message, key, SignOptions{Canonicalization: c.canon})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := Verify(c.change(signed), lookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[0].Err != c.expect {
+			t.Errorf("%s %s: expected %v, got %v", c.canon, c.comment, c.expect, results[0].Err)
+		}
+	}
+
+	if _, err := Sign(message, key, SignOptions{Canonicalization: "nofws"}); err == nil {
+		t.Error("expected unsupported canonicalization error")
+	}
+}
+
+func spaceInHeader(signed []byte) []byte {
+	return bytes.Replace(signed, []byte("Subject: hello world"), []byte("Subject:  hello \t world "), 1)
+}
+
+func spaceInBody(signed []byte) []byte {
+	return bytes.Replace(signed, []byte("html body</p>"), []byte("html \t body</p>  "), 1)
+}
+
+func trailingLines(signed []byte) []byte {
+	return append(signed, []byte("\r\n\r\n")...)
+}
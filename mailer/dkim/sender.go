@@ -0,0 +1,110 @@
+package dkim
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ivanjaros/ijlibs/mailer"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// signing keys by the domain of the From address. key with empty domain is used for any other domain.
+	// e-mails from domains without a key are sent unsigned.
+	Keys map[string]Key
+	// headers to sign, defaults to DefaultHeaders
+	Headers []string
+	// adds signature expiration if set
+	Expiration time.Duration
+	// used when the envelope has no From address, should be the same address the wrapped sender uses
+	From mail.Address
+}
+
+// Wraps the sender so each e-mail is rendered, signed and delivered as raw message.
+func New(sender mailer.RawSender, cfg Config) (*dkimSender, error) {
+	if sender == nil {
+		return nil, errors.New("no sender provided")
+	}
+	keys := make(map[string]Key, len(cfg.Keys))
+	for domain, key := range cfg.Keys {
+		if _, err := keyAlgorithm(key.Signer); err != nil {
+			return nil, err
+		}
+		keys[strings.ToLower(domain)] = key
+	}
+	cfg.Keys = keys
+	return &dkimSender{sender: sender, cfg: cfg}, nil
+}
+
+type dkimSender struct {
+	sender mailer.RawSender
+	cfg    Config
+}
+
+func (s *dkimSender) Provider() string {
+	return s.sender.Provider()
+}
+
+func (s *dkimSender) Close() error {
+	return s.sender.Close()
+}
+
+func (s *dkimSender) Send(envelope mailer.Envelope) (response string, msgId string, err error) {
+	defer envelope.Close()
+
+	if err := mailer.Validate(envelope); err != nil {
+		return "", "", err
+	}
+
+	buff := bytes.NewBuffer(nil)
+	msgId, err = mailer.Render(buff, envelope, mailer.RenderOptions{From: s.cfg.From})
+	if err != nil {
+		return "", "", err
+	}
+
+	from := s.cfg.From.Address
+	if f := envelope.From(); f != nil {
+		from = f.Address
+	}
+
+	message := buff.Bytes()
+	if key, ok := s.key(from); ok {
+		message, err = Sign(message, key, SignOptions{Headers: s.cfg.Headers, Expiration: s.cfg.Expiration})
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	// bounces go to the sender, if there is one
+	returnPath := from
+	if snd := envelope.Sender(); snd != nil {
+		returnPath = snd.Address
+	}
+
+	var to []string
+	for _, rec := range envelope.PublicRecipients() {
+		to = append(to, rec.Address)
+	}
+	for _, rec := range envelope.PrivateRecipients() {
+		to = append(to, rec.Address)
+	}
+
+	response, id, err := s.sender.SendRaw(returnPath, to, message)
+	if id != "" {
+		msgId = id
+	}
+	return response, msgId, err
+}
+
+func (s *dkimSender) key(from string) (Key, bool) {
+	domain := ""
+	if at := strings.LastIndexByte(from, '@'); at > -1 {
+		domain = strings.ToLower(from[at+1:])
+	}
+	if key, ok := s.cfg.Keys[domain]; ok {
+		return key, true
+	}
+	key, ok := s.cfg.Keys[""]
+	return key, ok
+}
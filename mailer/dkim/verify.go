@@ -0,0 +1,248 @@
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoSignature     = errors.New("message is not signed")
+	ErrInvalidBodyHash = errors.New("dkim body hash does not match")
+	ErrInvalidSig      = errors.New("dkim signature does not match")
+	ErrExpired         = errors.New("dkim signature has expired")
+)
+
+// Returns public key of the selector on the domain.
+type KeyLookup func(domain, selector string) (crypto.PublicKey, error)
+
+// Looks up the public key in DNS TXT record at <selector>._domainkey.<domain>.
+func LookupDNS(domain, selector string) (crypto.PublicKey, error) {
+	records, err := net.LookupTXT(selector + "._domainkey." + domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no dkim record found for %s._domainkey.%s", selector, domain)
+	}
+	// long records are split into multiple strings
+	return ParseRecord(strings.Join(records, ""))
+}
+
+// Parses public key from the TXT record, ie. "v=DKIM1; k=rsa; p=MIIBIjANBgkqh...".
+func ParseRecord(record string) (crypto.PublicKey, error) {
+	tags := parseTags(record)
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, errors.New("invalid dkim record version")
+	}
+	if tags["p"] == "" {
+		return nil, errors.New("dkim key has been revoked")
+	}
+	data, err := base64.StdEncoding.DecodeString(tags["p"])
+	if err != nil {
+		return nil, err
+	}
+
+	switch tags["k"] {
+	case "", "rsa":
+		pub, err := x509.ParsePKIXPublicKey(data)
+		if err != nil {
+			if pub, err := x509.ParsePKCS1PublicKey(data); err == nil {
+				return pub, nil
+			}
+			return nil, err
+		}
+		if _, ok := pub.(*rsa.PublicKey); ok == false {
+			return nil, ErrUnsupportedKey
+		}
+		return pub, nil
+	case "ed25519":
+		if len(data) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 dkim key")
+		}
+		return ed25519.PublicKey(data), nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// Creates the TXT record which publishes the public key.
+func Record(pub crypto.PublicKey) (string, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		data, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			return "", err
+		}
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(data), nil
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(k), nil
+	}
+	return "", ErrUnsupportedKey
+}
+
+type Verification struct {
+	Domain   string
+	Selector string
+	// names of the signed headers
+	Headers []string
+	Err     error
+}
+
+// Verifies all the signatures of the message. lookup defaults to LookupDNS.
+// Returns ErrNoSignature if there are none, otherwise the result of each signature is in its Verification.
+func Verify(message []byte, lookup KeyLookup) ([]Verification, error) {
+	if lookup == nil {
+		lookup = LookupDNS
+	}
+
+	message = normalizeNewlines(message)
+	headers, body := splitMessage(message)
+
+	var out []Verification
+	for k, h := range headers {
+		if strings.EqualFold(h.name, signatureHeader) == false {
+			continue
+		}
+		// signatures are prepended so one can sign only the headers below it, which were there before it was added
+		out = append(out, verify(headers[k+1:], body, h, lookup))
+	}
+
+	if len(out) == 0 {
+		return nil, ErrNoSignature
+	}
+	return out, nil
+}
+
+func verify(headers []header, body []byte, signature header, lookup KeyLookup) Verification {
+	value := signature.raw[strings.IndexByte(signature.raw, ':')+1:]
+	tags := parseTags(value)
+	v := Verification{Domain: tags["d"], Selector: tags["s"]}
+
+	if tags["v"] != "1" || v.Domain == "" || v.Selector == "" || tags["h"] == "" || tags["b"] == "" || tags["bh"] == "" {
+		v.Err = errors.New("invalid dkim signature")
+		return v
+	}
+
+	if x := tags["x"]; x != "" {
+		exp, err := strconv.ParseInt(x, 10, 64)
+		if err != nil {
+			v.Err = err
+			return v
+		}
+		if time.Now().Unix() > exp {
+			v.Err = ErrExpired
+			return v
+		}
+	}
+
+	headerCanon, bodyCanon, err := parseCanonicalization(tags["c"])
+	if err != nil {
+		v.Err = err
+		return v
+	}
+
+	canonBody := canonicalBody(body, bodyCanon)
+	if l := tags["l"]; l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 || n > len(canonBody) {
+			v.Err = errors.New("invalid dkim body length")
+			return v
+		}
+		canonBody = canonBody[:n]
+	}
+	bodyHash := sha256.Sum256(canonBody)
+	if base64.StdEncoding.EncodeToString(bodyHash[:]) != tags["bh"] {
+		v.Err = ErrInvalidBodyHash
+		return v
+	}
+
+	v.Headers = strings.Split(tags["h"], ":")
+	for k := range v.Headers {
+		v.Headers[k] = strings.TrimSpace(v.Headers[k])
+	}
+	signed := selectHeaders(headers, v.Headers)
+
+	hash := headerHash(signed, removeSignature(signature.raw), headerCanon)
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		v.Err = err
+		return v
+	}
+
+	pub, err := lookup(v.Domain, v.Selector)
+	if err != nil {
+		v.Err = err
+		return v
+	}
+
+	switch tags["a"] {
+	case AlgorithmRSA:
+		key, ok := pub.(*rsa.PublicKey)
+		if ok == false {
+			v.Err = ErrUnsupportedKey
+			return v
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash, sig); err != nil {
+			v.Err = ErrInvalidSig
+		}
+	case AlgorithmEd25519:
+		key, ok := pub.(ed25519.PublicKey)
+		if ok == false {
+			v.Err = ErrUnsupportedKey
+			return v
+		}
+		if ed25519.Verify(key, hash, sig) == false {
+			v.Err = ErrInvalidSig
+		}
+	default:
+		v.Err = errors.New("unsupported dkim algorithm: " + tags["a"])
+	}
+
+	return v
+}
+
+// removes the value of b= tag, keeping everything else including the folding
+func removeSignature(raw string) string {
+	colon := strings.IndexByte(raw, ':')
+	name, value := raw[:colon+1], raw[colon+1:]
+
+	parts := strings.Split(value, ";")
+	for k, p := range parts {
+		trimmed := strings.TrimLeft(p, " \t\r\n")
+		if strings.HasPrefix(trimmed, "b=") || strings.HasPrefix(trimmed, "b =") {
+			eq := strings.IndexByte(p, '=')
+			parts[k] = p[:eq+1]
+		}
+	}
+	return name + strings.Join(parts, ";")
+}
+
+// tag=value list, RFC 6376 section 3.2. whitespace is removed from the values.
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, p := range strings.Split(s, ";") {
+		eq := strings.IndexByte(p, '=')
+		if eq == -1 {
+			continue
+		}
+		name := strings.TrimSpace(p[:eq])
+		value := strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+				return -1
+			}
+			return r
+		}, p[eq+1:])
+		tags[name] = value
+	}
+	return tags
+}
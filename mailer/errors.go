@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"errors"
+	"net/textproto"
+)
+
+// PermanentError can be implemented by errors of the providers to report whether retrying the delivery
+// can succeed, ie. invalid recipient is permanent.
+type PermanentError interface {
+	error
+	Permanent() bool
+}
+
+// reports whether retrying the delivery cannot succeed. SMTP replies with 5xx code are permanent,
+// 4xx replies and other errors, like network failures, are temporary, unless they implement PermanentError.
+func IsPermanent(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var p PermanentError
+	if errors.As(err, &p) {
+		return p.Permanent()
+	}
+
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 500 && smtpErr.Code < 600
+	}
+
+	return false
+}
@@ -0,0 +1,84 @@
+package mail_queue
+
+import (
+	"encoding/json"
+	"github.com/ivanjaros/ijlibs/mailer"
+	"net/mail"
+)
+
+// serialisable copy of the envelope with all bodies and assets read into memory
+type envelopeData struct {
+	PublicRecipients  []mail.Address        `json:"cc"`
+	PrivateRecipients []mail.Address        `json:"bcc,omitempty"`
+	ReplyTo           *mail.Address         `json:"reply_to,omitempty"`
+	Sender            *mail.Address         `json:"sender,omitempty"`
+	From              *mail.Address         `json:"from,omitempty"`
+	Subject           string                `json:"subject"`
+	PlainBody         []byte                `json:"plain_body,omitempty"`
+	HTMLBody          []byte                `json:"html_body,omitempty"`
+	Attachments       []*mailer.MemoryAsset `json:"attachments,omitempty"`
+	Assets            []*mailer.MemoryAsset `json:"assets,omitempty"`
+	Headers           map[string][]string   `json:"headers,omitempty"`
+}
+
+// reads the whole envelope so it can be stored, the envelope is not closed
+func encodeEnvelope(e mailer.Envelope) ([]byte, error) {
+	var err error
+	d := envelopeData{
+		PublicRecipients:  e.PublicRecipients(),
+		PrivateRecipients: e.PrivateRecipients(),
+		ReplyTo:           e.ReplyTo(),
+		Sender:            e.Sender(),
+		From:              e.From(),
+		Subject:           e.Subject(),
+		Headers:           e.Headers(),
+	}
+	if d.PlainBody, err = mailer.ReadBody(e.PlainBody()); err != nil {
+		return nil, err
+	}
+	if d.HTMLBody, err = mailer.ReadBody(e.HTMLBody()); err != nil {
+		return nil, err
+	}
+	if d.Attachments, err = mailer.ReadAssets(e.Attachments()); err != nil {
+		return nil, err
+	}
+	if d.Assets, err = mailer.ReadAssets(e.Assets()); err != nil {
+		return nil, err
+	}
+	return json.Marshal(&d)
+}
+
+func decodeEnvelope(data []byte) (*mailer.Message, error) {
+	var d envelopeData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+
+	msg := new(mailer.Message)
+	msg.SetTo(d.PublicRecipients)
+	msg.SetHiddenRecipients(d.PrivateRecipients)
+	if d.ReplyTo != nil {
+		msg.SetReplyTo(*d.ReplyTo)
+	}
+	if d.Sender != nil {
+		msg.SetSender(*d.Sender)
+	}
+	if d.From != nil {
+		msg.SetFrom(*d.From)
+	}
+	msg.SetSubject(d.Subject)
+	if d.PlainBody != nil {
+		msg.SetBody(d.PlainBody)
+	}
+	if d.HTMLBody != nil {
+		msg.SetHtml(d.HTMLBody)
+	}
+	if len(d.Attachments) > 0 {
+		msg.SetAttachments(mailer.Assets(d.Attachments))
+	}
+	if len(d.Assets) > 0 {
+		msg.SetAssets(mailer.Assets(d.Assets))
+	}
+	msg.SetHeaders(d.Headers)
+	return msg, nil
+}
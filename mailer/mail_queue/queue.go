@@ -0,0 +1,181 @@
+// Package mail_queue delivers e-mails in the background with retries so a temporary failure
+// of the provider does not fail the request which sends the e-mail.
+package mail_queue
+
+import (
+	"context"
+	"errors"
+	"github.com/ivanjaros/ijlibs/mailer"
+	"github.com/ivanjaros/ijlibs/workers"
+	"sync"
+	"time"
+)
+
+const Provider = "queue"
+
+// response returned by Send() once the e-mail is queued
+const QueuedResponse = "queued"
+
+type Status int
+
+const (
+	Delivered Status = iota
+	// the delivery failed and it will be retried
+	Retrying
+	// the delivery failed permanently or too many times and the e-mail has been moved into the dead letter
+	Failed
+)
+
+type Outcome struct {
+	// id returned by Send()
+	Id      string
+	Status  Status
+	Attempt int
+	// response and message id of the provider, if it delivered the e-mail
+	Response string
+	MsgId    string
+	Err      error
+}
+
+type Config struct {
+	// number of e-mails delivered concurrently, defaults to 1
+	Workers int
+	// defaults to workers.DefaultRetryPolicy
+	Retry workers.RetryPolicy
+	// how often the store is checked for e-mails waiting for retry, defaults to 1 second
+	PollInterval time.Duration
+	// how long the queue waits for deliveries in progress when it is closed, defaults to 30 seconds
+	DrainTimeout time.Duration
+	// decides whether the delivery error is permanent, defaults to isPermanent
+	IsPermanent func(err error) bool
+	// called after each delivery attempt, optional
+	OnOutcome func(o Outcome)
+	// called when the store fails, optional
+	OnError func(err error)
+}
+
+// Wraps the sender so e-mails are stored and delivered in the background. store can be a spool directory
+// created by NewSpool(), Badger store from workers/bqueue or any other workers.JobStore.
+// Send() returns QueuedResponse and id of the queued e-mail, the outcome of the delivery is reported to OnOutcome.
+func New(sender mailer.Sender, store workers.JobStore, cfg Config) *queueSender {
+	if cfg.Retry.MaxAttempts < 1 {
+		cfg.Retry = workers.DefaultRetryPolicy
+	}
+	if cfg.IsPermanent == nil {
+		cfg.IsPermanent = isPermanent
+	}
+
+	q := &queueSender{sender: sender, cfg: cfg, done: make(chan struct{})}
+	q.queue = workers.NewQueue(store, q.deliver, workers.QueueConfig{
+		Workers:      cfg.Workers,
+		PollInterval: cfg.PollInterval,
+		DrainTimeout: cfg.DrainTimeout,
+		Retry:        cfg.Retry,
+		OnError:      cfg.OnError,
+	})
+
+	var ctx context.Context
+	ctx, q.cancel = context.WithCancel(context.Background())
+	go func() {
+		defer close(q.done)
+		q.queue.Run(ctx)
+	}()
+	return q
+}
+
+type queueSender struct {
+	sender mailer.Sender
+	cfg    Config
+	queue  workers.Queue
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (q *queueSender) Provider() string {
+	return Provider
+}
+
+func (q *queueSender) Send(envelope mailer.Envelope) (response string, msgId string, err error) {
+	defer envelope.Close()
+
+	if err := mailer.Validate(envelope); err != nil {
+		return "", "", err
+	}
+
+	data, err := encodeEnvelope(envelope)
+	if err != nil {
+		return "", "", err
+	}
+
+	job := &workers.Job{Kind: Provider, Payload: data}
+	if err := q.queue.Enqueue(job); err != nil {
+		return "", "", err
+	}
+	return QueuedResponse, job.Id, nil
+}
+
+func (q *queueSender) deliver(ctx context.Context, job *workers.Job) error {
+	msg, err := decodeEnvelope(job.Payload)
+	if err != nil {
+		// the stored e-mail is corrupted so it can never be delivered
+		err = workers.Permanent(err)
+		q.report(Outcome{Id: job.Id, Status: Failed, Attempt: job.Attempts, Err: err})
+		return err
+	}
+
+	response, msgId, err := q.sender.Send(msg)
+	if err == nil {
+		q.report(Outcome{Id: job.Id, Status: Delivered, Attempt: job.Attempts, Response: response, MsgId: msgId})
+		return nil
+	}
+
+	if q.cfg.IsPermanent(err) || job.Attempts >= q.cfg.Retry.MaxAttempts {
+		q.report(Outcome{Id: job.Id, Status: Failed, Attempt: job.Attempts, Response: response, Err: err})
+		return workers.Permanent(err)
+	}
+
+	q.report(Outcome{Id: job.Id, Status: Retrying, Attempt: job.Attempts, Response: response, Err: err})
+	return err
+}
+
+// errors are permanent according to mailer.IsPermanent, or when the sender marked them with workers.Permanent(),
+// ie. when it is a queue itself. permanent errors are passed to the queue marked by workers.Permanent().
+func isPermanent(err error) bool {
+	return mailer.IsPermanent(err) || workers.IsPermanent(err)
+}
+
+func (q *queueSender) report(o Outcome) {
+	if q.cfg.OnOutcome != nil {
+		q.cfg.OnOutcome(o)
+	}
+}
+
+// returns e-mails which could not be delivered
+func (q *queueSender) Dead() ([]mailer.Envelope, error) {
+	jobs, err := q.queue.Dead()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]mailer.Envelope, 0, len(jobs))
+	for _, job := range jobs {
+		msg, err := decodeEnvelope(job.Payload)
+		if err != nil {
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out, nil
+}
+
+// stops the queue, waits for the deliveries in progress and closes the wrapped sender.
+// queued e-mails stay in the store and are delivered once the queue is created again.
+func (q *queueSender) Close() error {
+	err := errors.New("mail queue is already closed")
+	q.once.Do(func() {
+		q.cancel()
+		<-q.done
+		err = q.sender.Close()
+	})
+	return err
+}
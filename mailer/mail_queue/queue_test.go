@@ -0,0 +1,259 @@
+package mail_queue
+
+import (
+	"errors"
+	"github.com/ivanjaros/ijlibs/mailer"
+	"github.com/ivanjaros/ijlibs/workers"
+	"io/ioutil"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fails the first "failures" deliveries with err and records subjects of the delivered e-mails
+type testSender struct {
+	mx        sync.Mutex
+	failures  int
+	err       error
+	attempts  int
+	delivered []mailer.Envelope
+}
+
+func (s *testSender) Provider() string {
+	return "test"
+}
+
+func (s *testSender) Send(envelope mailer.Envelope) (string, string, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.attempts++
+	if s.attempts <= s.failures {
+		return "rejected", "", s.err
+	}
+	s.delivered = append(s.delivered, envelope)
+	return "ok", "msg-id", nil
+}
+
+func (s *testSender) Close() error {
+	return nil
+}
+
+// collects outcomes and signals once the e-mail has been delivered or it has failed
+type outcomes struct {
+	mx   sync.Mutex
+	list []Outcome
+	done chan struct{}
+}
+
+func newOutcomes() *outcomes {
+	return &outcomes{done: make(chan struct{}, 10)}
+}
+
+func (o *outcomes) add(out Outcome) {
+	o.mx.Lock()
+	o.list = append(o.list, out)
+	o.mx.Unlock()
+	if out.Status != Retrying {
+		o.done <- struct{}{}
+	}
+}
+
+func (o *outcomes) wait(t *testing.T) []Outcome {
+	t.Helper()
+	select {
+	case <-o.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("e-mail has not been processed")
+	}
+	o.mx.Lock()
+	defer o.mx.Unlock()
+	return append([]Outcome(nil), o.list...)
+}
+
+func testConfig(o *outcomes) Config {
+	return Config{
+		PollInterval: 10 * time.Millisecond,
+		Retry:        workers.RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond},
+		OnOutcome:    o.add,
+	}
+}
+
+func testMessage() *mailer.Message {
+	msg := new(mailer.Message)
+	msg.SetTo([]mail.Address{{Name: "John", Address: "john@example.com"}})
+	msg.SetSubject("hello")
+	msg.SetBody([]byte("plain"))
+	msg.SetHtml([]byte(`<img src="cid:logo.png">`))
+	msg.SetAssets([]mailer.Asset{mailer.NewAsset("logo.png", "image/png", []byte("png"))})
+	return msg
+}
+
+func statuses(list []Outcome) []Status {
+	out := make([]Status, len(list))
+	for k := range list {
+		out[k] = list[k].Status
+	}
+	return out
+}
+
+func equalStatuses(a, b []Status) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	data, err := encodeEnvelope(testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := decodeEnvelope(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Subject() != "hello" || len(msg.PublicRecipients()) != 1 || msg.PublicRecipients()[0].Address != "john@example.com" {
+		t.Fatalf("unexpected decoded message %+v", msg)
+	}
+	if body, _ := ioutil.ReadAll(msg.PlainBody()); string(body) != "plain" {
+		t.Fatalf("unexpected plain body %q", body)
+	}
+	assets := msg.Assets()
+	if len(assets) != 1 || assets[0].FileName() != "logo.png" || assets[0].MimeType() != "image/png" {
+		t.Fatalf("unexpected assets %+v", assets)
+	}
+	if data, _ := ioutil.ReadAll(assets[0].Data()); string(data) != "png" {
+		t.Fatalf("unexpected asset data %q", data)
+	}
+}
+
+func TestQueueRetries(t *testing.T) {
+	o := newOutcomes()
+	sender := &testSender{failures: 2, err: errors.New("connection refused")}
+	q := New(sender, workers.NewMemoryJobStore(), testConfig(o))
+	defer q.Close()
+
+	response, id, err := q.Send(testMessage())
+	if err != nil || response != QueuedResponse || id == "" {
+		t.Fatalf("unexpected send result %q %q %v", response, id, err)
+	}
+
+	list := o.wait(t)
+	if expect := []Status{Retrying, Retrying, Delivered}; equalStatuses(statuses(list), expect) == false {
+		t.Fatalf("expected %v, got %v", expect, statuses(list))
+	}
+	last := list[len(list)-1]
+	if last.Id != id || last.Attempt != 3 || last.Response != "ok" || last.MsgId != "msg-id" {
+		t.Fatalf("unexpected outcome %+v", last)
+	}
+	if len(sender.delivered) != 1 || sender.delivered[0].Subject() != "hello" {
+		t.Fatal("e-mail has not been delivered")
+	}
+}
+
+func TestQueueFailure(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		expect []Status
+	}{
+		{"attempts exhausted", errors.New("connection refused"), []Status{Retrying, Retrying, Failed}},
+		{"permanent", &textproto.Error{Code: 550, Msg: "no such user"}, []Status{Failed}},
+		{"marked permanent", workers.Permanent(errors.New("invalid recipient")), []Status{Failed}},
+	}
+
+	for _, c := range cases {
+		o := newOutcomes()
+		sender := &testSender{failures: 10, err: c.err}
+		q := New(sender, workers.NewMemoryJobStore(), testConfig(o))
+
+		if _, _, err := q.Send(testMessage()); err != nil {
+			t.Fatal(err)
+		}
+		list := o.wait(t)
+		if equalStatuses(statuses(list), c.expect) == false {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expect, statuses(list))
+		}
+		if list[len(list)-1].Err == nil {
+			t.Errorf("%s: failed outcome has no error", c.name)
+		}
+
+		dead, err := q.Dead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dead) != 1 || dead[0].Subject() != "hello" {
+			t.Errorf("%s: expected the e-mail in the dead letter, got %d", c.name, len(dead))
+		}
+		q.Close()
+	}
+}
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+
+	// nothing is running the queue so the e-mail stays in the spool
+	s, err := NewSpool(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := encodeEnvelope(testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(&workers.Job{Id: "queued", Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Bury(&workers.Job{Id: "dead", Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "queued"+spoolExt)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, deadDir, "dead"+spoolExt)); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopened spool delivers the queued e-mail and keeps the dead one
+	s, err = NewSpool(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := newOutcomes()
+	sender := &testSender{}
+	q := New(sender, s, testConfig(o))
+	defer q.Close()
+
+	if list := o.wait(t); list[0].Id != "queued" || list[0].Status != Delivered {
+		t.Fatalf("unexpected outcome %+v", list[0])
+	}
+	dead, err := q.Dead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 {
+		t.Fatalf("expected single dead e-mail, got %d", len(dead))
+	}
+
+	// the delivered e-mail is removed from the spool
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "queued"+spoolExt)); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("delivered e-mail is still in the spool")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,137 @@
+package mail_queue
+
+import (
+	"encoding/json"
+	"github.com/ivanjaros/ijlibs/workers"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	spoolExt = ".json"
+	deadDir  = "dead"
+)
+
+// Creates job store which keeps each queued e-mail as a file in the directory, and the failed ones
+// in its "dead" subdirectory. the files are loaded into memory when the spool is opened
+// so it is meant to be used by a single process. leases are not persisted so e-mails which were
+// being delivered when the process exited are delivered again.
+func NewSpool(dir string) (*spool, error) {
+	if err := os.MkdirAll(filepath.Join(dir, deadDir), 0755); err != nil {
+		return nil, err
+	}
+
+	s := &spool{dir: dir, mem: workers.NewMemoryJobStore()}
+	if err := s.load(dir, s.mem.Save); err != nil {
+		return nil, err
+	}
+	if err := s.load(filepath.Join(dir, deadDir), s.mem.Bury); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type spool struct {
+	mx  sync.Mutex
+	dir string
+	mem workers.JobStore
+}
+
+func (s *spool) load(dir string, add func(job *workers.Job) error) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasSuffix(e.Name(), spoolExt) == false {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		job := new(workers.Job)
+		if err := json.Unmarshal(data, job); err != nil {
+			return err
+		}
+		job.LeaseUntil = time.Time{}
+		if err := add(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *spool) path(id string, dead bool) string {
+	if dead {
+		return filepath.Join(s.dir, deadDir, id+spoolExt)
+	}
+	return filepath.Join(s.dir, id+spoolExt)
+}
+
+// writes into temporary file first so a crash does not leave partially written job behind
+func (s *spool) write(job *workers.Job, dead bool) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	path := s.path(job.Id, dead)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *spool) Save(job *workers.Job) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if err := s.write(job, false); err != nil {
+		return err
+	}
+	return s.mem.Save(job)
+}
+
+func (s *spool) Lease(now, until time.Time) (*workers.Job, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	job, err := s.mem.Lease(now, until)
+	if err != nil || job == nil {
+		return job, err
+	}
+	// persists the attempts
+	return job, s.write(job, false)
+}
+
+func (s *spool) Touch(id string, until time.Time) error {
+	return s.mem.Touch(id, until)
+}
+
+func (s *spool) Delete(id string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if err := os.Remove(s.path(id, false)); err != nil && os.IsNotExist(err) == false {
+		return err
+	}
+	return s.mem.Delete(id)
+}
+
+func (s *spool) Bury(job *workers.Job) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if err := s.write(job, true); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(job.Id, false)); err != nil && os.IsNotExist(err) == false {
+		return err
+	}
+	return s.mem.Bury(job)
+}
+
+func (s *spool) Buried() ([]*workers.Job, error) {
+	return s.mem.Buried()
+}
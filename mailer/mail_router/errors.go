@@ -0,0 +1,47 @@
+package mail_router
+
+import (
+	"github.com/ivanjaros/ijlibs/mailer"
+	"strings"
+)
+
+// error of a single sender
+type ProviderError struct {
+	Provider string
+	Err      error
+}
+
+func (e *ProviderError) Error() string {
+	return e.Provider + ": " + e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// errors of all the senders which were tried
+type Errors []*ProviderError
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	msgs := make([]string, len(e))
+	for k := range e {
+		msgs[k] = e[k].Error()
+	}
+	return "all senders failed:\n- " + strings.Join(msgs, "\n- ")
+}
+
+// the failure is permanent when the last sender failed permanently, since only permanent
+// error stops the failover, so there is no point in retrying the e-mail later.
+func (e Errors) Permanent() bool {
+	return len(e) > 0 && mailer.IsPermanent(e[len(e)-1].Err)
+}
+
+func (e Errors) Unwrap() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e[len(e)-1]
+}
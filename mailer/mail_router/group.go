@@ -0,0 +1,38 @@
+package mail_router
+
+// senders of a single route
+type group struct {
+	strategy Strategy
+	senders  []*senderState
+	weights  []int
+	// current weights of the smooth weighted round-robin
+	current []int
+}
+
+// returns the senders in the order they should be tried, must be called under the router's lock
+func (g *group) order() []*senderState {
+	out := make([]*senderState, 0, len(g.senders))
+	if g.strategy != RoundRobin || len(g.senders) == 1 {
+		return append(out, g.senders...)
+	}
+
+	// smooth weighted round-robin spreads the picks evenly instead of picking
+	// the heaviest sender several times in a row
+	total, best := 0, 0
+	for k, w := range g.weights {
+		g.current[k] += w
+		total += w
+		if g.current[k] > g.current[best] {
+			best = k
+		}
+	}
+	g.current[best] -= total
+
+	out = append(out, g.senders[best])
+	for k, st := range g.senders {
+		if k != best {
+			out = append(out, st)
+		}
+	}
+	return out
+}
@@ -0,0 +1,314 @@
+// Package mail_router composes multiple senders into one, with failover, weighted round-robin,
+// routing by recipient domains and ejection of unhealthy senders.
+package mail_router
+
+import (
+	"errors"
+	"github.com/ivanjaros/ijlibs/mailer"
+	"strings"
+	"sync"
+	"time"
+)
+
+const Provider = "router"
+
+type Strategy int
+
+const (
+	// senders are tried in the given order
+	Failover Strategy = iota
+	// first sender is picked by weighted round-robin, the others are tried in the given order if it fails
+	RoundRobin
+)
+
+type Target struct {
+	Sender mailer.Sender
+	// used by RoundRobin strategy, defaults to 1
+	Weight int
+}
+
+type Rule struct {
+	// recipient domains, "*.example.com" matches all subdomains and "*" matches any domain.
+	// the rule is used only when all the recipients, including the private ones, match.
+	Domains  []string
+	Targets  []Target
+	Strategy Strategy
+}
+
+type Config struct {
+	// senders used when no rule matches
+	Targets  []Target
+	Strategy Strategy
+	// first matching rule is used
+	Rules []Rule
+	// number of consecutive failures after which the sender is ejected, defaults to 3
+	MaxFailures int
+	// how long the ejected sender is skipped, defaults to 30 seconds. after that it gets another try
+	// and a single failure ejects it again.
+	EjectFor time.Duration
+	// permanent errors, ie. rejected recipient, are returned right away without trying other senders
+	// and do not count as failure of the sender. defaults to mailer.IsPermanent
+	IsPermanent func(err error) bool
+	// called when a sender gets ejected, optional
+	OnEject func(provider string, err error)
+}
+
+type SenderStatus struct {
+	Provider     string
+	Healthy      bool
+	Failures     int
+	EjectedUntil time.Time
+	LastError    error
+}
+
+type Router interface {
+	mailer.Sender
+	// returns health of all the senders
+	Status() []SenderStatus
+}
+
+// Creates sender which routes the e-mails to the configured senders.
+// The response and message id are the ones of the sender which actually sent the e-mail.
+func New(cfg Config) (Router, error) {
+	if cfg.MaxFailures < 1 {
+		cfg.MaxFailures = 3
+	}
+	if cfg.EjectFor <= 0 {
+		cfg.EjectFor = 30 * time.Second
+	}
+	if cfg.IsPermanent == nil {
+		cfg.IsPermanent = mailer.IsPermanent
+	}
+
+	r := &router{cfg: cfg, now: time.Now}
+
+	var err error
+	if r.def, err = r.newGroup(cfg.Targets, cfg.Strategy); err != nil {
+		return nil, err
+	}
+	for _, rule := range cfg.Rules {
+		if len(rule.Domains) == 0 {
+			return nil, errors.New("routing rule has no domains")
+		}
+		g, err := r.newGroup(rule.Targets, rule.Strategy)
+		if err != nil {
+			return nil, err
+		}
+		domains := make([]string, len(rule.Domains))
+		for k := range rule.Domains {
+			domains[k] = strings.ToLower(strings.TrimSpace(rule.Domains[k]))
+		}
+		r.rules = append(r.rules, route{domains: domains, group: g})
+	}
+
+	return r, nil
+}
+
+type router struct {
+	mx      sync.Mutex
+	cfg     Config
+	def     *group
+	rules   []route
+	senders []*senderState
+	now     func() time.Time
+}
+
+type route struct {
+	domains []string
+	group   *group
+}
+
+type senderState struct {
+	sender       mailer.Sender
+	failures     int
+	ejectedUntil time.Time
+	lastErr      error
+}
+
+func (r *router) newGroup(targets []Target, strategy Strategy) (*group, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("no senders provided")
+	}
+	g := &group{strategy: strategy, current: make([]int, len(targets))}
+	for _, t := range targets {
+		if t.Sender == nil {
+			return nil, errors.New("missing sender")
+		}
+		if t.Weight < 1 {
+			t.Weight = 1
+		}
+		g.senders = append(g.senders, r.state(t.Sender))
+		g.weights = append(g.weights, t.Weight)
+	}
+	return g, nil
+}
+
+// the same sender can be used by multiple groups but it has single health state
+func (r *router) state(s mailer.Sender) *senderState {
+	for _, st := range r.senders {
+		if st.sender == s {
+			return st
+		}
+	}
+	st := &senderState{sender: s}
+	r.senders = append(r.senders, st)
+	return st
+}
+
+func (r *router) Provider() string {
+	return Provider
+}
+
+func (r *router) Send(envelope mailer.Envelope) (response string, msgId string, err error) {
+	defer envelope.Close()
+
+	if err := mailer.Validate(envelope); err != nil {
+		return "", "", err
+	}
+
+	// the envelope can be read only once so each sender gets its own copy
+	snap, err := snapshot(envelope)
+	if err != nil {
+		return "", "", err
+	}
+
+	g := r.route(envelope)
+	var errs Errors
+	for _, st := range r.order(g) {
+		response, msgId, err = st.sender.Send(snap.message())
+		if err == nil {
+			r.succeeded(st)
+			return response, msgId, nil
+		}
+
+		errs = append(errs, &ProviderError{Provider: st.sender.Provider(), Err: err})
+		if r.cfg.IsPermanent(err) {
+			break
+		}
+		r.failed(st, err)
+	}
+
+	return "", "", errs
+}
+
+// picks the group of the first rule matching all the recipients, the default one if there are no recipients
+func (r *router) route(envelope mailer.Envelope) *group {
+	if len(r.rules) == 0 {
+		return r.def
+	}
+
+	var domains []string
+	for _, list := range [][]string{addresses(envelope.PublicRecipients()), addresses(envelope.PrivateRecipients())} {
+		for _, addr := range list {
+			domain := ""
+			if at := strings.LastIndexByte(addr, '@'); at > -1 {
+				domain = strings.ToLower(addr[at+1:])
+			}
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) == 0 {
+		return r.def
+	}
+
+	for _, rule := range r.rules {
+		matches := true
+		for _, d := range domains {
+			if matchDomain(rule.domains, d) == false {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return rule.group
+		}
+	}
+	return r.def
+}
+
+func matchDomain(patterns []string, domain string) bool {
+	for _, p := range patterns {
+		switch {
+		case p == "*" || p == domain:
+			return true
+		case strings.HasPrefix(p, "*.") && strings.HasSuffix(domain, p[1:]):
+			return true
+		}
+	}
+	return false
+}
+
+// returns the healthy senders in the order they should be tried, followed by the ejected ones
+// so the e-mail is not lost when all the senders are ejected.
+func (r *router) order(g *group) []*senderState {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	now := r.now()
+	ordered := g.order()
+	healthy := make([]*senderState, 0, len(ordered))
+	var ejected []*senderState
+	for _, st := range ordered {
+		if st.ejectedUntil.After(now) {
+			ejected = append(ejected, st)
+		} else {
+			healthy = append(healthy, st)
+		}
+	}
+	return append(healthy, ejected...)
+}
+
+func (r *router) succeeded(st *senderState) {
+	r.mx.Lock()
+	st.failures = 0
+	st.ejectedUntil = time.Time{}
+	st.lastErr = nil
+	r.mx.Unlock()
+}
+
+func (r *router) failed(st *senderState, err error) {
+	r.mx.Lock()
+	st.failures++
+	st.lastErr = err
+	eject := st.failures >= r.cfg.MaxFailures
+	if eject {
+		st.ejectedUntil = r.now().Add(r.cfg.EjectFor)
+	}
+	r.mx.Unlock()
+
+	if eject && r.cfg.OnEject != nil {
+		r.cfg.OnEject(st.sender.Provider(), err)
+	}
+}
+
+func (r *router) Status() []SenderStatus {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	now := r.now()
+	out := make([]SenderStatus, len(r.senders))
+	for k, st := range r.senders {
+		out[k] = SenderStatus{
+			Provider:     st.sender.Provider(),
+			Healthy:      st.ejectedUntil.After(now) == false,
+			Failures:     st.failures,
+			EjectedUntil: st.ejectedUntil,
+			LastError:    st.lastErr,
+		}
+	}
+	return out
+}
+
+// closes all the senders
+func (r *router) Close() error {
+	var errs []string
+	for _, st := range r.senders {
+		if err := st.sender.Close(); err != nil {
+			errs = append(errs, st.sender.Provider()+": "+err.Error())
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New("failed to close senders:\n- " + strings.Join(errs, "\n- "))
+}
@@ -0,0 +1,240 @@
+package mail_router
+
+import (
+	"errors"
+	"github.com/ivanjaros/ijlibs/mailer"
+	"net/mail"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSender struct {
+	mx       sync.Mutex
+	name     string
+	err      error
+	subjects []string
+}
+
+func (s *testSender) Provider() string {
+	return s.name
+}
+
+func (s *testSender) Send(envelope mailer.Envelope) (string, string, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.subjects = append(s.subjects, envelope.Subject())
+	if s.err != nil {
+		return s.name + " rejected", "", s.err
+	}
+	return s.name + " ok", s.name + "-id", nil
+}
+
+func (s *testSender) Close() error {
+	return nil
+}
+
+func (s *testSender) fail(err error) {
+	s.mx.Lock()
+	s.err = err
+	s.mx.Unlock()
+}
+
+func (s *testSender) calls() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return len(s.subjects)
+}
+
+func testMessage(to ...string) *mailer.Message {
+	msg := new(mailer.Message)
+	list := make([]mail.Address, len(to))
+	for k := range to {
+		list[k] = mail.Address{Address: to[k]}
+	}
+	msg.SetTo(list)
+	msg.SetSubject("hello")
+	msg.SetBody([]byte("body"))
+	return msg
+}
+
+func TestFailover(t *testing.T) {
+	a := &testSender{name: "a", err: errors.New("connection refused")}
+	b := &testSender{name: "b"}
+	r, err := New(Config{Targets: []Target{{Sender: a}, {Sender: b}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, msgId, err := r.Send(testMessage("john@example.com"))
+	if err != nil || response != "b ok" || msgId != "b-id" {
+		t.Fatalf("unexpected result %q %q %v", response, msgId, err)
+	}
+	// each sender gets the whole envelope
+	if a.subjects[0] != "hello" || b.subjects[0] != "hello" {
+		t.Fatalf("unexpected subjects %v %v", a.subjects, b.subjects)
+	}
+	if status := r.Status(); status[0].Failures != 1 || status[0].LastError == nil || status[1].Failures != 0 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	b.fail(errors.New("timeout"))
+	response, msgId, err = r.Send(testMessage("john@example.com"))
+	var errs Errors
+	if errors.As(err, &errs) == false || len(errs) != 2 || errs[0].Provider != "a" || errs[1].Provider != "b" {
+		t.Fatalf("expected errors of both senders, got %v", err)
+	}
+	if response != "" || msgId != "" {
+		t.Fatalf("failed send returned response %q and id %q", response, msgId)
+	}
+	if mailer.IsPermanent(err) {
+		t.Fatal("temporary failures are permanent")
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	a := &testSender{name: "a"}
+	b := &testSender{name: "b"}
+	r, err := New(Config{
+		Targets:  []Target{{Sender: a, Weight: 3}, {Sender: b, Weight: 1}},
+		Strategy: RoundRobin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var picks []string
+	for i := 0; i < 40; i++ {
+		response, _, err := r.Send(testMessage("john@example.com"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		picks = append(picks, response)
+	}
+	if a.calls() != 30 || b.calls() != 10 {
+		t.Fatalf("expected 30:10 distribution, got %d:%d", a.calls(), b.calls())
+	}
+	// smooth round-robin does not pick the lighter sender twice in a row
+	for k := 1; k < len(picks); k++ {
+		if picks[k] == "b ok" && picks[k-1] == "b ok" {
+			t.Fatalf("lighter sender picked in a row %v", picks)
+		}
+	}
+}
+
+func TestEjection(t *testing.T) {
+	now := time.Now()
+	a := &testSender{name: "a", err: errors.New("connection refused")}
+	b := &testSender{name: "b"}
+	var ejected []string
+	r, err := New(Config{
+		Targets:     []Target{{Sender: a}, {Sender: b}},
+		MaxFailures: 2,
+		EjectFor:    time.Minute,
+		OnEject: func(provider string, err error) {
+			ejected = append(ejected, provider)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.(*router).now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := r.Send(testMessage("john@example.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ejected) != 1 || ejected[0] != "a" || r.Status()[0].Healthy {
+		t.Fatalf("sender has not been ejected %v %+v", ejected, r.Status())
+	}
+
+	// ejected sender is skipped
+	if _, _, err := r.Send(testMessage("john@example.com")); err != nil || a.calls() != 2 || b.calls() != 3 {
+		t.Fatalf("ejected sender has been used, %d calls", a.calls())
+	}
+
+	// ejected sender is still used when all the others are failing
+	b.fail(errors.New("timeout"))
+	if _, _, err := r.Send(testMessage("john@example.com")); err == nil || a.calls() != 3 {
+		t.Fatalf("ejected sender has not been tried last, %d calls", a.calls())
+	}
+	b.fail(nil)
+
+	// after the ejection the sender gets another try and a single failure ejects it again
+	now = now.Add(2 * time.Minute)
+	n := len(ejected)
+	if _, _, err := r.Send(testMessage("john@example.com")); err != nil || a.calls() != 4 {
+		t.Fatalf("sender has not been tried after the ejection, %d calls", a.calls())
+	}
+	if len(ejected) != n+1 || r.Status()[0].Healthy {
+		t.Fatalf("sender has not been ejected again %v", ejected)
+	}
+
+	// recovered sender is healthy again
+	now = now.Add(2 * time.Minute)
+	a.fail(nil)
+	if response, _, err := r.Send(testMessage("john@example.com")); err != nil || response != "a ok" {
+		t.Fatalf("recovered sender has not been used %q %v", response, err)
+	}
+	if status := r.Status()[0]; status.Healthy == false || status.Failures != 0 || status.LastError != nil {
+		t.Fatalf("unexpected status of recovered sender %+v", status)
+	}
+}
+
+func TestPermanentError(t *testing.T) {
+	a := &testSender{name: "a", err: &textproto.Error{Code: 550, Msg: "no such user"}}
+	b := &testSender{name: "b"}
+	r, err := New(Config{Targets: []Target{{Sender: a}, {Sender: b}}, MaxFailures: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = r.Send(testMessage("john@example.com"))
+	if err == nil || mailer.IsPermanent(err) == false {
+		t.Fatalf("expected permanent error, got %v", err)
+	}
+	if b.calls() != 0 {
+		t.Fatal("permanent error has not stopped the failover")
+	}
+	if status := r.Status()[0]; status.Healthy == false || status.Failures != 0 {
+		t.Fatalf("permanent error counted as failure of the sender %+v", status)
+	}
+}
+
+func TestRules(t *testing.T) {
+	def := &testSender{name: "default"}
+	internal := &testSender{name: "internal"}
+	r, err := New(Config{
+		Targets: []Target{{Sender: def}},
+		Rules:   []Rule{{Domains: []string{"example.com", "*.example.com"}, Targets: []Target{{Sender: internal}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		to     []string
+		expect string
+	}{
+		{[]string{"john@example.com"}, "internal ok"},
+		{[]string{"john@mail.EXAMPLE.com", "jane@example.com"}, "internal ok"},
+		{[]string{"john@example.com", "jane@example.org"}, "default ok"},
+		{[]string{"john@notexample.com"}, "default ok"},
+	}
+	for _, c := range cases {
+		response, _, err := r.Send(testMessage(c.to...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response != c.expect {
+			t.Errorf("%v: expected %s, got %s", c.to, c.expect, response)
+		}
+	}
+
+	// envelope without recipients does not match any rule
+	if g := r.(*router).route(testMessage()); g != r.(*router).def {
+		t.Error("envelope without recipients has been routed by a rule")
+	}
+}
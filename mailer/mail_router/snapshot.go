@@ -0,0 +1,83 @@
+package mail_router
+
+import (
+	"github.com/ivanjaros/ijlibs/mailer"
+	"net/mail"
+)
+
+// copy of the envelope with bodies and assets in memory
+type envelopeSnapshot struct {
+	cc          []mail.Address
+	bcc         []mail.Address
+	replyTo     *mail.Address
+	sender      *mail.Address
+	from        *mail.Address
+	subject     string
+	plainBody   []byte
+	htmlBody    []byte
+	attachments []*mailer.MemoryAsset
+	assets      []*mailer.MemoryAsset
+	headers     map[string][]string
+}
+
+func snapshot(e mailer.Envelope) (*envelopeSnapshot, error) {
+	s := &envelopeSnapshot{
+		cc:      e.PublicRecipients(),
+		bcc:     e.PrivateRecipients(),
+		replyTo: e.ReplyTo(),
+		sender:  e.Sender(),
+		from:    e.From(),
+		subject: e.Subject(),
+		headers: e.Headers(),
+	}
+
+	var err error
+	if s.plainBody, err = mailer.ReadBody(e.PlainBody()); err != nil {
+		return nil, err
+	}
+	if s.htmlBody, err = mailer.ReadBody(e.HTMLBody()); err != nil {
+		return nil, err
+	}
+	if s.attachments, err = mailer.ReadAssets(e.Attachments()); err != nil {
+		return nil, err
+	}
+	if s.assets, err = mailer.ReadAssets(e.Assets()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// creates new message which can be read and closed by the sender
+func (s *envelopeSnapshot) message() *mailer.Message {
+	msg := new(mailer.Message)
+	msg.SetTo(s.cc)
+	msg.SetHiddenRecipients(s.bcc)
+	if s.replyTo != nil {
+		msg.SetReplyTo(*s.replyTo)
+	}
+	if s.sender != nil {
+		msg.SetSender(*s.sender)
+	}
+	if s.from != nil {
+		msg.SetFrom(*s.from)
+	}
+	msg.SetSubject(s.subject)
+	if len(s.plainBody) > 0 {
+		msg.SetBody(s.plainBody)
+	}
+	if len(s.htmlBody) > 0 {
+		msg.SetHtml(s.htmlBody)
+	}
+	msg.SetAttachments(mailer.Assets(s.attachments))
+	msg.SetAssets(mailer.Assets(s.assets))
+	msg.SetHeaders(s.headers)
+	return msg
+}
+
+func addresses(list []mail.Address) []string {
+	out := make([]string, len(list))
+	for k := range list {
+		out[k] = list[k].Address
+	}
+	return out
+}
@@ -0,0 +1,38 @@
+package mail_template
+
+import (
+	"github.com/ivanjaros/ijlibs/mailer"
+	"io/fs"
+	"mime"
+	"path"
+	"regexp"
+)
+
+// matches references of embedded images in src attributes and css urls
+var cidRef = regexp.MustCompile(`cid:([^"'()\s>]+)`)
+
+// loads assets referenced by the html
+func (t *templates) assets(html string) ([]mailer.Asset, error) {
+	var out []mailer.Asset
+	seen := make(map[string]bool)
+
+	for _, m := range cidRef.FindAllStringSubmatch(html, -1) {
+		name := m[1]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		data, err := fs.ReadFile(t.fs, path.Join(assetsDir, name))
+		if err != nil {
+			return nil, err
+		}
+		mimeType := mime.TypeByExtension(path.Ext(name))
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		out = append(out, mailer.NewAsset(name, mimeType, data))
+	}
+
+	return out, nil
+}
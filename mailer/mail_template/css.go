@@ -0,0 +1,18 @@
+package mail_template
+
+import (
+	"github.com/vanng822/go-premailer/premailer"
+)
+
+// moves the css from <style> elements into style attributes since many mail clients ignore the style elements.
+// rules which can not be inlined, ie. media queries, are kept in the <style> element.
+func inlineCSS(html string) (string, error) {
+	if html == "" {
+		return "", nil
+	}
+	p, err := premailer.NewPremailerFromString(html, premailer.NewOptions())
+	if err != nil {
+		return "", err
+	}
+	return p.Transform()
+}
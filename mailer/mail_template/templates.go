@@ -0,0 +1,347 @@
+// Package mail_template renders e-mails from templates stored in a file system.
+//
+// The file system is expected to have following structure:
+//
+//	layouts/<layout>.html          html layout, the template is included by {{template "content" .}}
+//	layouts/<layout>.txt           plain text layout
+//	assets/<file name>             images embedded into the e-mails, referenced as "cid:<file name>"
+//	<template>/<locale>/subject.txt
+//	<template>/<locale>/body.html  html body, at least one of the bodies is required
+//	<template>/<locale>/body.txt   plain text body, derived from the html body if missing
+//
+// Templates can override the layout, ie. {{define "layout"}}other{{end}} in subject.txt,
+// which is useful for e-mails without any layout by using {{define "layout"}}none{{end}}.
+// Only the default layout is optional, any other layout must exist for each body of the templates using it.
+package mail_template
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ivanjaros/ijlibs/mailer"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	DefaultLocale = "en"
+	DefaultLayout = "default"
+	// layout name which disables the layout
+	NoLayout = "none"
+
+	layoutsDir  = "layouts"
+	assetsDir   = "assets"
+	subjectFile = "subject.txt"
+	htmlFile    = "body.html"
+	textFile    = "body.txt"
+	contentName = "content"
+	layoutName  = "layout"
+)
+
+var ErrTemplateNotFound = errors.New("e-mail template not found")
+
+type Config struct {
+	// locale used when the template has no variant for the requested locale, defaults to DefaultLocale
+	DefaultLocale string
+	// layout used by templates which do not specify their own, defaults to DefaultLayout
+	Layout string
+	// functions available in all templates
+	Funcs map[string]interface{}
+}
+
+type Templates interface {
+	// Renders the template in the locale, or the closest available one.
+	Render(name, locale string, data interface{}) (*Rendered, error)
+	// Renders the template into new message, only the recipients and sender need to be set.
+	Message(name, locale string, data interface{}) (*mailer.Message, error)
+	// Returns locales available for the template, sorted.
+	Locales(name string) []string
+}
+
+type Rendered struct {
+	// locale actually used
+	Locale  string
+	Subject string
+	Text    string
+	// html with inlined css
+	HTML string
+	// images referenced by the html
+	Assets []mailer.Asset
+}
+
+// Loads and parses all the templates so any error is caught early.
+func New(fsys fs.FS, cfg Config) (*templates, error) {
+	if fsys == nil {
+		return nil, errors.New("no file system provided")
+	}
+	if cfg.DefaultLocale == "" {
+		cfg.DefaultLocale = DefaultLocale
+	}
+	cfg.DefaultLocale = normalizeLocale(cfg.DefaultLocale)
+	if cfg.Layout == "" {
+		cfg.Layout = DefaultLayout
+	}
+
+	t := &templates{fs: fsys, cfg: cfg, variants: make(map[string]map[string]*variant)}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+type templates struct {
+	fs       fs.FS
+	cfg      Config
+	variants map[string]map[string]*variant
+}
+
+type variant struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+func (t *templates) load() error {
+	entries, err := fs.ReadDir(t.fs, ".")
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.IsDir() == false || e.Name() == layoutsDir || e.Name() == assetsDir {
+			continue
+		}
+		locales, err := fs.ReadDir(t.fs, e.Name())
+		if err != nil {
+			return err
+		}
+		for _, l := range locales {
+			if l.IsDir() == false {
+				continue
+			}
+			v, err := t.loadVariant(path.Join(e.Name(), l.Name()))
+			if err != nil {
+				return fmt.Errorf("%s/%s: %w", e.Name(), l.Name(), err)
+			}
+			if t.variants[e.Name()] == nil {
+				t.variants[e.Name()] = make(map[string]*variant)
+			}
+			t.variants[e.Name()][normalizeLocale(l.Name())] = v
+		}
+	}
+
+	return nil
+}
+
+func (t *templates) loadVariant(dir string) (*variant, error) {
+	subject, err := t.readFile(path.Join(dir, subjectFile), true)
+	if err != nil {
+		return nil, err
+	}
+	htmlBody, err := t.readFile(path.Join(dir, htmlFile), false)
+	if err != nil {
+		return nil, err
+	}
+	textBody, err := t.readFile(path.Join(dir, textFile), false)
+	if err != nil {
+		return nil, err
+	}
+	if htmlBody == "" && textBody == "" {
+		return nil, errors.New("template has no body")
+	}
+
+	v := new(variant)
+	if v.subject, err = texttemplate.New(subjectFile).Funcs(t.cfg.Funcs).Parse(subject); err != nil {
+		return nil, err
+	}
+
+	layout := t.cfg.Layout
+	if l := v.subject.Lookup(layoutName); l != nil {
+		var sb strings.Builder
+		if err := l.Execute(&sb, nil); err != nil {
+			return nil, err
+		}
+		layout = strings.TrimSpace(sb.String())
+	}
+
+	if htmlBody != "" {
+		if v.html, err = t.parseHTML(layout, htmlBody); err != nil {
+			return nil, err
+		}
+	}
+	if textBody != "" {
+		if v.text, err = t.parseText(layout, textBody); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// parses the body as "content" template into the layout, if there is one
+func (t *templates) parseHTML(layout, body string) (*htmltemplate.Template, error) {
+	tpl := htmltemplate.New(layoutName).Funcs(t.cfg.Funcs)
+	src, err := t.readLayout(layout, ".html")
+	if err != nil {
+		return nil, err
+	}
+	if src == "" {
+		src = `{{template "` + contentName + `" .}}`
+	}
+	if _, err := tpl.Parse(src); err != nil {
+		return nil, err
+	}
+	if _, err := tpl.New(contentName).Parse(body); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+func (t *templates) parseText(layout, body string) (*texttemplate.Template, error) {
+	tpl := texttemplate.New(layoutName).Funcs(t.cfg.Funcs)
+	src, err := t.readLayout(layout, ".txt")
+	if err != nil {
+		return nil, err
+	}
+	if src == "" {
+		src = `{{template "` + contentName + `" .}}`
+	}
+	if _, err := tpl.Parse(src); err != nil {
+		return nil, err
+	}
+	if _, err := tpl.New(contentName).Parse(body); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// missing default layout means there is none, other layouts are required so a typo in the name is caught
+func (t *templates) readLayout(layout, ext string) (string, error) {
+	if layout == NoLayout {
+		return "", nil
+	}
+	src, err := t.readFile(path.Join(layoutsDir, layout+ext), layout != DefaultLayout)
+	if err != nil {
+		return "", fmt.Errorf("layout %s: %w", layout, err)
+	}
+	return src, nil
+}
+
+func (t *templates) readFile(name string, required bool) (string, error) {
+	data, err := fs.ReadFile(t.fs, name)
+	if err != nil {
+		if required == false && errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (t *templates) Locales(name string) []string {
+	out := make([]string, 0, len(t.variants[name]))
+	for l := range t.variants[name] {
+		out = append(out, l)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// picks the variant for the locale, falling back to the base language(ie. "de" for "de-at")
+// and then to the default locale and its base language.
+func (t *templates) variant(name, locale string) (*variant, string, error) {
+	variants, ok := t.variants[name]
+	if ok == false {
+		return nil, "", ErrTemplateNotFound
+	}
+	for _, l := range fallbackLocales(normalizeLocale(locale), t.cfg.DefaultLocale) {
+		if v, ok := variants[l]; ok {
+			return v, l, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%w: no variant of %s for locale %s", ErrTemplateNotFound, name, locale)
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+func fallbackLocales(locale, def string) []string {
+	out := make([]string, 0, 4)
+	for _, l := range []string{locale, def} {
+		for l != "" {
+			out = append(out, l)
+			dash := strings.LastIndexByte(l, '-')
+			if dash == -1 {
+				break
+			}
+			l = l[:dash]
+		}
+	}
+	return out
+}
+
+func (t *templates) Render(name, locale string, data interface{}) (*Rendered, error) {
+	v, used, err := t.variant(name, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Rendered{Locale: used}
+
+	buff := bytes.NewBuffer(nil)
+	if err := v.subject.Execute(buff, data); err != nil {
+		return nil, err
+	}
+	// subject must be a single line
+	r.Subject = strings.Join(strings.Fields(buff.String()), " ")
+
+	if v.html != nil {
+		buff.Reset()
+		if err := v.html.Execute(buff, data); err != nil {
+			return nil, err
+		}
+		if r.HTML, err = inlineCSS(buff.String()); err != nil {
+			return nil, err
+		}
+		if r.Assets, err = t.assets(r.HTML); err != nil {
+			return nil, err
+		}
+	}
+
+	if v.text != nil {
+		buff.Reset()
+		if err := v.text.Execute(buff, data); err != nil {
+			return nil, err
+		}
+		r.Text = buff.String()
+	} else {
+		if r.Text, err = HTMLToText(r.HTML); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (t *templates) Message(name, locale string, data interface{}) (*mailer.Message, error) {
+	r, err := t.Render(name, locale, data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(mailer.Message)
+	msg.SetSubject(r.Subject)
+	msg.SetBody([]byte(r.Text))
+	if r.HTML != "" {
+		msg.SetHtml([]byte(r.HTML))
+	}
+	if len(r.Assets) > 0 {
+		msg.SetAssets(r.Assets)
+	}
+	return msg, nil
+}
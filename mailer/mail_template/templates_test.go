@@ -0,0 +1,148 @@
+package mail_template
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"layouts/default.html": {Data: []byte(`<html><head><style>p { color: red; }</style></head><body>{{template "content" .}}</body></html>`)},
+		"layouts/plain.html":   {Data: []byte(`<div>{{template "content" .}}</div>`)},
+		"assets/logo.png":      {Data: []byte("png")},
+
+		"welcome/en/subject.txt": {Data: []byte("Welcome\n{{.}}")},
+		"welcome/en/body.html":   {Data: []byte(`<p>Hello {{.}}</p><img src="cid:logo.png" alt="logo">`)},
+		"welcome/de/subject.txt": {Data: []byte("Willkommen {{.}}")},
+		"welcome/de/body.html":   {Data: []byte(`<p>Hallo {{.}}</p>`)},
+		"welcome/de/body.txt":    {Data: []byte("Hallo {{.}}, in Textform")},
+		"welcome/sk/subject.txt": {Data: []byte(`{{define "layout"}}plain{{end}}Vitaj {{.}}`)},
+		"welcome/sk/body.html":   {Data: []byte(`<p>Ahoj {{.}}</p>`)},
+
+		"bare/en/subject.txt": {Data: []byte(`{{define "layout"}}none{{end}}Bare`)},
+		"bare/en/body.html":   {Data: []byte(`<p>bare {{.}}</p>`)},
+	}
+}
+
+func TestLocaleFallback(t *testing.T) {
+	tpl, err := New(testFS(), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"en":    "en",
+		"de":    "de",
+		"de-AT": "de",
+		"de_at": "de",
+		"sk-SK": "sk",
+		"fr":    "en",
+		"":      "en",
+	}
+	for locale, expect := range cases {
+		r, err := tpl.Render("welcome", locale, "John")
+		if err != nil {
+			t.Fatalf("%q: %v", locale, err)
+		}
+		if r.Locale != expect {
+			t.Errorf("%q: expected %s, got %s", locale, expect, r.Locale)
+		}
+	}
+
+	if locales := tpl.Locales("welcome"); strings.Join(locales, ",") != "de,en,sk" {
+		t.Errorf("unexpected locales %v", locales)
+	}
+
+	if _, err := tpl.Render("missing", "en", nil); errors.Is(err, ErrTemplateNotFound) == false {
+		t.Errorf("expected template not found, got %v", err)
+	}
+	tpl, err = New(testFS(), Config{DefaultLocale: "es"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.Render("welcome", "fr", nil); errors.Is(err, ErrTemplateNotFound) == false {
+		t.Errorf("expected missing variant, got %v", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tpl, err := New(testFS(), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := tpl.Render("welcome", "en", "John")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Subject != "Welcome John" {
+		t.Errorf("unexpected subject %q", r.Subject)
+	}
+	// css of the layout is inlined
+	if strings.Contains(r.HTML, `<p style="color:red">Hello John</p>`) == false {
+		t.Errorf("css has not been inlined into %s", r.HTML)
+	}
+	// text is derived from the html
+	if strings.TrimSpace(r.Text) != "Hello John\n\nlogo" {
+		t.Errorf("unexpected derived text %q", r.Text)
+	}
+	if len(r.Assets) != 1 || r.Assets[0].FileName() != "logo.png" || r.Assets[0].MimeType() != "image/png" {
+		t.Fatalf("unexpected assets %+v", r.Assets)
+	}
+	if data, _ := ioutil.ReadAll(r.Assets[0].Data()); string(data) != "png" {
+		t.Errorf("unexpected asset data %q", data)
+	}
+
+	r, err = tpl.Render("welcome", "de", "John")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Text != "Hallo John, in Textform" || len(r.Assets) != 0 {
+		t.Errorf("unexpected rendered template %+v", r)
+	}
+
+	r, err = tpl.Render("welcome", "sk", "John")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.HTML != `<html><head></head><body><div><p>Ahoj John</p></div></body></html>` {
+		t.Errorf("template has not used its own layout %s", r.HTML)
+	}
+
+	r, err = tpl.Render("bare", "en", "John")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(r.HTML, "<div>") || strings.Contains(r.HTML, "<style>") {
+		t.Errorf("template without layout has one %s", r.HTML)
+	}
+}
+
+func TestMissingLayout(t *testing.T) {
+	// typo in the configured layout
+	if _, err := New(testFS(), Config{Layout: "defualt"}); errors.Is(err, fs.ErrNotExist) == false {
+		t.Errorf("expected missing configured layout, got %v", err)
+	}
+
+	// typo in the layout of the template
+	fsys := testFS()
+	fsys["welcome/sk/subject.txt"] = &fstest.MapFile{Data: []byte(`{{define "layout"}}plian{{end}}Vitaj`)}
+	if _, err := New(fsys, Config{}); errors.Is(err, fs.ErrNotExist) == false {
+		t.Errorf("expected missing layout of the template, got %v", err)
+	}
+
+	// default layout is optional
+	fsys = testFS()
+	delete(fsys, "layouts/default.html")
+	tpl, err := New(fsys, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := tpl.Render("welcome", "de", "John"); err != nil || r.HTML != `<html><head></head><body><p>Hallo John</p></body></html>` {
+		t.Errorf("unexpected rendered template without default layout %+v %v", r, err)
+	}
+}
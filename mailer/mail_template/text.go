@@ -0,0 +1,202 @@
+package mail_template
+
+import (
+	"golang.org/x/net/html"
+	"io"
+	"strings"
+)
+
+// elements whose content is not visible
+var skippedElements = map[string]bool{
+	"head": true, "style": true, "script": true, "title": true, "template": true,
+}
+
+// elements which separate paragraphs of text
+var blockElements = map[string]bool{
+	"p": true, "div": true, "table": true, "tr": true, "ul": true, "ol": true, "blockquote": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"section": true, "article": true, "header": true, "footer": true, "pre": true,
+}
+
+// Converts html into readable plain text. Links are written as "text (url)",
+// images as their alt text and list items are prefixed with "- ".
+func HTMLToText(src string) (string, error) {
+	if src == "" {
+		return "", nil
+	}
+
+	w := &textWriter{}
+	z := html.NewTokenizer(strings.NewReader(src))
+	skip := 0
+	var links []string
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return w.String(), nil
+			}
+			return "", z.Err()
+
+		case html.TextToken:
+			if skip == 0 {
+				w.text(string(z.Text()))
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			attrs := make(map[string]string)
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[string(k)] = string(v)
+			}
+
+			if skippedElements[tag] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+
+			switch {
+			case tag == "br":
+				w.newLine()
+			case tag == "hr":
+				w.paragraph()
+				w.raw("----------")
+				w.paragraph()
+			case tag == "li":
+				w.newLine()
+				w.raw("- ")
+			case tag == "img":
+				w.text(attrs["alt"])
+			case tag == "a":
+				links = append(links, attrs["href"])
+				w.markLink()
+			case tag == "td" || tag == "th":
+				w.text(" ")
+			case blockElements[tag]:
+				w.paragraph()
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+
+			if skippedElements[tag] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+
+			switch {
+			case tag == "a" && len(links) > 0:
+				href := links[len(links)-1]
+				links = links[:len(links)-1]
+				w.link(href)
+			case blockElements[tag]:
+				w.paragraph()
+			}
+		}
+	}
+}
+
+type textWriter struct {
+	sb strings.Builder
+	// pending whitespace, written only before the next text
+	space    bool
+	newLines int
+	// start of the text of the current link
+	linkStart int
+}
+
+func (w *textWriter) String() string {
+	return strings.TrimSpace(w.sb.String()) + "\n"
+}
+
+// writes text with collapsed whitespace
+func (w *textWriter) text(s string) {
+	if s == "" {
+		return
+	}
+	if isSpace(s[0]) {
+		w.space = true
+	}
+	fields := strings.Fields(s)
+	for k, f := range fields {
+		if k > 0 {
+			w.space = true
+		}
+		w.flush()
+		w.sb.WriteString(f)
+	}
+	if len(fields) > 0 && isSpace(s[len(s)-1]) {
+		w.space = true
+	}
+}
+
+func (w *textWriter) raw(s string) {
+	w.flush()
+	w.sb.WriteString(s)
+}
+
+func (w *textWriter) flush() {
+	if w.sb.Len() == 0 {
+		w.space, w.newLines = false, 0
+		return
+	}
+	if w.newLines > 0 {
+		w.sb.WriteString(strings.Repeat("\n", w.newLines))
+	} else if w.space {
+		w.sb.WriteByte(' ')
+	}
+	w.space, w.newLines = false, 0
+}
+
+func (w *textWriter) newLine() {
+	if w.newLines < 1 {
+		w.newLines = 1
+	}
+}
+
+func (w *textWriter) paragraph() {
+	w.newLines = 2
+}
+
+func (w *textWriter) markLink() {
+	w.linkStart = w.sb.Len()
+}
+
+// appends the url after the link text, unless it is the same as the text or it is not a real url
+func (w *textWriter) link(href string) {
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "cid:") {
+		return
+	}
+	text := ""
+	if w.linkStart <= w.sb.Len() {
+		text = strings.TrimSpace(w.sb.String()[w.linkStart:])
+	}
+	if text == href || "mailto:"+text == href {
+		return
+	}
+	if text == "" {
+		w.text(href)
+		return
+	}
+	w.space = true
+	w.raw("(" + href + ")")
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
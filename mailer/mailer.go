@@ -17,6 +17,14 @@ type Sender interface {
 	Close() error
 }
 
+// Senders which can deliver already rendered message(see Render()) as it is, without building their own.
+// This is required by decorators which modify the rendered message, ie. DKIM signing.
+type RawSender interface {
+	Sender
+	// from is the envelope sender(MAIL FROM) and to are all the recipients, including the private ones.
+	SendRaw(from string, to []string, message []byte) (response string, msgId string, err error)
+}
+
 type Envelope interface {
 	// CC, required
 	PublicRecipients() []mail.Address
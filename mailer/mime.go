@@ -0,0 +1,339 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"github.com/ivanjaros/ijlibs/random"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maximum length of a line recommended by RFC 5322
+	maxLineLength = 78
+	// length of base64 encoded lines, RFC 2045
+	base64LineLength = 76
+)
+
+type RenderOptions struct {
+	// used when the envelope has no From address
+	From mail.Address
+	// defaults to current time
+	Date time.Time
+	// defaults to Message-ID header of the envelope or randomly generated id on the domain of the From address
+	MessageId string
+}
+
+// Renders the envelope into RFC 5322 message with MIME body and returns its Message-ID, without angle brackets.
+// Plain and HTML bodies are sent as multipart/alternative, assets are related to the HTML body
+// and can be referenced by "cid:<file name>", see ContentId(), attachments are added into multipart/mixed.
+// Private recipients are not written into the message. The envelope is not closed.
+func Render(w io.Writer, envelope Envelope, opts RenderOptions) (msgId string, err error) {
+	hdr := make(textproto.MIMEHeader)
+
+	from := &opts.From
+	if f := envelope.From(); f != nil {
+		from = f
+	}
+	hdr.Set("From", from.String())
+
+	if s := envelope.Sender(); s != nil {
+		hdr.Set("Sender", s.String())
+	}
+	if r := envelope.ReplyTo(); r != nil {
+		hdr.Set("Reply-To", r.String())
+	}
+	if to := envelope.PublicRecipients(); len(to) > 0 {
+		hdr.Set("To", addressList(to))
+	}
+	hdr.Set("Subject", mime.QEncoding.Encode("utf-8", envelope.Subject()))
+
+	date := opts.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	hdr.Set("Date", date.Format(time.RFC1123Z))
+
+	msgId = opts.MessageId
+	if msgId == "" {
+		msgId = strings.Trim(envelope.Headers().Get("Message-Id"), "<> ")
+	}
+	if msgId == "" {
+		msgId = MessageId(from.Address)
+	}
+	hdr.Set("Message-Id", "<"+msgId+">")
+	hdr.Set("Mime-Version", "1.0")
+
+	// custom headers can not override the ones above
+	for k, vals := range envelope.Headers() {
+		k = textproto.CanonicalMIMEHeaderKey(k)
+		if _, ok := hdr[k]; ok || k == "Bcc" || strings.HasPrefix(k, "Content-") {
+			continue
+		}
+		for _, v := range vals {
+			hdr.Add(k, mime.QEncoding.Encode("utf-8", v))
+		}
+	}
+
+	body, err := buildBody(envelope)
+	if err != nil {
+		return "", err
+	}
+	for k, vals := range body.header {
+		hdr[k] = vals
+	}
+
+	bw := bufio.NewWriter(w)
+	writeHeader(bw, hdr)
+	bw.WriteString("\r\n")
+	if err := body.write(bw); err != nil {
+		return "", err
+	}
+	return msgId, bw.Flush()
+}
+
+// Generates new unique message id, without angle brackets, for the domain of the address.
+func MessageId(address string) string {
+	domain := "localhost"
+	if at := strings.LastIndexByte(address, '@'); at > -1 && at < len(address)-1 {
+		domain = address[at+1:]
+	}
+	id := time.Now().UTC().Format("20060102150405") + "." + random.String(16, random.AlphaSetLC, random.NumSet)
+	return id + "@" + domain
+}
+
+// returns Content-ID, without angle brackets, of the asset with provided file name.
+// file names which are valid in "cid:" url are used as they are, other characters are percent-encoded
+// so the html has to reference such asset by the encoded name.
+func ContentId(fileName string) string {
+	var sb strings.Builder
+	for i := 0; i < len(fileName); i++ {
+		c := fileName[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"%'()<>[\]`, c) > -1 {
+			sb.WriteByte('%')
+			sb.WriteByte("0123456789ABCDEF"[c>>4])
+			sb.WriteByte("0123456789ABCDEF"[c&0xf])
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func addressList(list []mail.Address) string {
+	out := make([]string, len(list))
+	for k := range list {
+		out[k] = list[k].String()
+	}
+	return strings.Join(out, ", ")
+}
+
+// entity is a single MIME part which can be either a leaf with content or a multipart container
+type entity struct {
+	header textproto.MIMEHeader
+	// leaf, with either data or asset which is opened when the part is written and closed afterwards
+	data     io.Reader
+	asset    Asset
+	encoding string
+	// multipart
+	boundary string
+	parts    []*entity
+}
+
+func (e *entity) write(w io.Writer) error {
+	if e.asset != nil {
+		r := e.asset.Data()
+		defer r.Close()
+		return writeContent(w, r, e.encoding)
+	}
+	if len(e.parts) == 0 {
+		return writeContent(w, e.data, e.encoding)
+	}
+
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(e.boundary); err != nil {
+		return err
+	}
+	for _, p := range e.parts {
+		pw, err := mw.CreatePart(p.header)
+		if err != nil {
+			return err
+		}
+		if err := p.write(pw); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func newMultipart(subtype string, parts ...*entity) *entity {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	boundary := multipart.NewWriter(nil).Boundary()
+	hdr := make(textproto.MIMEHeader)
+	hdr.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": boundary}))
+	return &entity{header: hdr, boundary: boundary, parts: parts}
+}
+
+func newText(mimeType string, body []byte) *entity {
+	hdr := make(textproto.MIMEHeader)
+	hdr.Set("Content-Type", mimeType+"; charset=utf-8")
+	hdr.Set("Content-Transfer-Encoding", "quoted-printable")
+	return &entity{header: hdr, data: bytes.NewReader(body), encoding: "quoted-printable"}
+}
+
+func newAsset(a Asset, disposition string) *entity {
+	mimeType := mime.FormatMediaType(a.MimeType(), map[string]string{"name": a.FileName()})
+	if mimeType == "" {
+		mimeType = mime.FormatMediaType("application/octet-stream", map[string]string{"name": a.FileName()})
+	}
+
+	hdr := make(textproto.MIMEHeader)
+	hdr.Set("Content-Type", mimeType)
+	hdr.Set("Content-Transfer-Encoding", "base64")
+	hdr.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.FileName()}))
+	if disposition == "inline" {
+		hdr.Set("Content-Id", "<"+ContentId(a.FileName())+">")
+	}
+	return &entity{header: hdr, asset: a, encoding: "base64"}
+}
+
+func buildBody(envelope Envelope) (*entity, error) {
+	plain, err := ReadBody(envelope.PlainBody())
+	if err != nil {
+		return nil, err
+	}
+	html, err := ReadBody(envelope.HTMLBody())
+	if err != nil {
+		return nil, err
+	}
+
+	var alternative []*entity
+	if len(plain) > 0 || len(html) == 0 {
+		alternative = append(alternative, newText("text/plain", plain))
+	}
+	if len(html) > 0 {
+		related := []*entity{newText("text/html", html)}
+		for _, a := range envelope.Assets() {
+			related = append(related, newAsset(a, "inline"))
+		}
+		alternative = append(alternative, newMultipart("related", related...))
+	}
+
+	mixed := []*entity{newMultipart("alternative", alternative...)}
+	for _, a := range envelope.Attachments() {
+		mixed = append(mixed, newAsset(a, "attachment"))
+	}
+	return newMultipart("mixed", mixed...), nil
+}
+
+func writeContent(w io.Writer, r io.Reader, encoding string) error {
+	if encoding == "base64" {
+		enc := base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: w, max: base64LineLength})
+		if _, err := io.Copy(enc, r); err != nil {
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\r\n")
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.Copy(qp, r); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// breaks the encoded data into lines
+type lineWrapper struct {
+	w   io.Writer
+	max int
+	n   int
+}
+
+func (lw *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if lw.n == lw.max {
+			if _, err := io.WriteString(lw.w, "\r\n"); err != nil {
+				return written, err
+			}
+			lw.n = 0
+		}
+		chunk := lw.max - lw.n
+		if chunk > len(p) {
+			chunk = len(p)
+		}
+		n, err := lw.w.Write(p[:chunk])
+		written += n
+		lw.n += n
+		if err != nil {
+			return written, err
+		}
+		p = p[chunk:]
+	}
+	return written, nil
+}
+
+// headers are written in stable order so the output can be compared and signed
+func writeHeader(w *bufio.Writer, hdr textproto.MIMEHeader) {
+	keys := make([]string, 0, len(hdr))
+	for k := range hdr {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range hdr[k] {
+			w.WriteString(foldHeader(k, sanitizeHeader(v)))
+			w.WriteString("\r\n")
+		}
+	}
+}
+
+// prevents header injection
+func sanitizeHeader(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
+
+// breaks long header lines on spaces, but never right after the header name
+func foldHeader(key, value string) string {
+	line := key + ": " + value
+	if len(line) <= maxLineLength {
+		return line
+	}
+	var sb strings.Builder
+	from := len(key) + 2
+	for len(line) > maxLineLength {
+		at := -1
+		// long header name leaves no space for the value on the first line
+		if from < maxLineLength {
+			at = strings.LastIndexByte(line[from:maxLineLength], ' ')
+		}
+		if at < 0 {
+			at = strings.IndexByte(line[from:], ' ')
+			if at < 0 {
+				break
+			}
+		}
+		at += from
+		sb.WriteString(line[:at])
+		sb.WriteString("\r\n")
+		line = line[at:]
+		// the first character of continued line is the folding space itself
+		from = 1
+	}
+	sb.WriteString(line)
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package mailer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestFoldHeader(t *testing.T) {
+	cases := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{"short", "Subject", "hello"},
+		{"long value", "Subject", strings.Repeat("word ", 40)},
+		{"long key", "X-" + strings.Repeat("k", 80), "some value with spaces"},
+		{"key at limit", strings.Repeat("k", maxLineLength-1), "a b"},
+		{"no spaces", "Subject", strings.Repeat("x", 200)},
+	}
+
+	for _, c := range cases {
+		folded := foldHeader(c.key, c.value)
+		if unfolded := strings.ReplaceAll(folded, "\r\n", ""); unfolded != c.key+": "+c.value {
+			t.Errorf("%s: folding changed the header into %q", c.name, unfolded)
+		}
+		lines := strings.Split(folded, "\r\n")
+		for k, line := range lines[1:] {
+			if strings.HasPrefix(line, " ") == false {
+				t.Errorf("%s: continued line %d does not start with space", c.name, k+1)
+			}
+		}
+		// continued line can be longer than the limit only if it is a single word
+		for k, line := range lines[1:] {
+			if len(line) > maxLineLength && strings.Contains(line[1:], " ") {
+				t.Errorf("%s: line %d is too long %q", c.name, k+1, line)
+			}
+		}
+	}
+}
+
+func TestContentId(t *testing.T) {
+	cases := map[string]string{
+		"logo.png":      "logo.png",
+		"logo@site.com": "logo@site.com",
+		"my logo.png":   "my%20logo.png",
+		"a>b<c.png":     "a%3Eb%3Cc.png",
+		"100%.png":      "100%25.png",
+		"x\r\nBcc: y":   "x%0D%0ABcc:%20y",
+		"ľogo.png":      "%C4%BEogo.png",
+	}
+	for name, expect := range cases {
+		if id := ContentId(name); id != expect {
+			t.Errorf("%q: expected %q, got %q", name, expect, id)
+		}
+	}
+}
+
+func TestRenderInlineAsset(t *testing.T) {
+	msg := new(Message)
+	msg.SetTo([]mail.Address{{Address: "john@example.com"}})
+	msg.SetFrom(mail.Address{Address: "noreply@example.com"})
+	msg.SetSubject("hello")
+	msg.SetHtml([]byte(`<img src="cid:my%20logo.png">`))
+	msg.SetAssets([]Asset{NewAsset("my logo.png", "image/png", []byte("png"))})
+
+	buf := bytes.NewBuffer(nil)
+	if _, err := Render(buf, msg, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "Content-Id: <my%20logo.png>\r\n") == false {
+		t.Fatalf("asset has no escaped content id:\n%s", buf.String())
+	}
+}
+
+func TestRenderClosesAssets(t *testing.T) {
+	asset, attachment := &testAsset{data: "png"}, &testAsset{data: "txt"}
+	msg := new(Message)
+	msg.SetTo([]mail.Address{{Address: "john@example.com"}})
+	msg.SetFrom(mail.Address{Address: "noreply@example.com"})
+	msg.SetHtml([]byte(`<img src="cid:file.txt">`))
+	msg.SetAssets([]Asset{asset})
+	msg.SetAttachments([]Asset{attachment})
+
+	if _, err := Render(ioutil.Discard, msg, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if asset.closed != 1 || attachment.closed != 1 {
+		t.Fatalf("assets have not been closed, %d %d", asset.closed, attachment.closed)
+	}
+}
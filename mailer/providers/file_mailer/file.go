@@ -19,12 +19,24 @@ func New(from mail.Address, directory string) (*fileSender, error) {
 	if FileExists(directory) == false {
 		return nil, errors.New("directory does not exist")
 	}
-	return &fileSender{from, directory}, nil
+	return &fileSender{from: from, dir: directory}, nil
+}
+
+// Same as New() but the e-mails are written as .eml files, which can be opened by any mail client,
+// instead of yaml. The returned message id is the Message-ID of the e-mail.
+func NewEml(from mail.Address, directory string) (*fileSender, error) {
+	s, err := New(from, directory)
+	if err != nil {
+		return nil, err
+	}
+	s.eml = true
+	return s, nil
 }
 
 type fileSender struct {
 	from mail.Address
 	dir  string
+	eml  bool
 }
 
 func (s fileSender) Provider() string {
@@ -40,6 +52,10 @@ func (s *fileSender) Send(envelope mailer.Envelope) (response string, msgId stri
 
 	defer envelope.Close()
 
+	if s.eml {
+		return s.sendEml(envelope)
+	}
+
 	cc := envelope.PublicRecipients()
 	for k := range cc {
 		e.CC = append(e.CC, cc[k].String())
@@ -110,6 +126,49 @@ func (s *fileSender) Send(envelope mailer.Envelope) (response string, msgId stri
 	return "", id, nil
 }
 
+func (s *fileSender) sendEml(envelope mailer.Envelope) (response string, msgId string, err error) {
+	buff := bytes.NewBuffer(nil)
+	msgId, err = mailer.Render(buff, envelope, mailer.RenderOptions{From: s.from})
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.writeEml(msgId, buff.Bytes()); err != nil {
+		return err.Error(), "", err
+	}
+
+	return "", msgId, nil
+}
+
+// writes already rendered message as .eml file, regardless of the format of the sender.
+// the returned message id is the Message-ID of the message, or randomly generated id if it has none.
+func (s *fileSender) SendRaw(from string, to []string, message []byte) (response string, msgId string, err error) {
+	if len(to) == 0 {
+		return "", "", errors.New("no recipients set")
+	}
+	if msg, err := mail.ReadMessage(bytes.NewReader(message)); err == nil {
+		msgId = strings.Trim(msg.Header.Get("Message-Id"), "<> ")
+	}
+	if msgId == "" {
+		msgId = mailer.MessageId(from)
+	}
+	if err := s.writeEml(msgId, message); err != nil {
+		return err.Error(), "", err
+	}
+	return "", msgId, nil
+}
+
+// the file is named after the message id, characters which are not safe in file names are replaced
+func (s *fileSender) writeEml(msgId string, message []byte) error {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@.-_+", r) {
+			return r
+		}
+		return '_'
+	}, msgId)
+	return ioutil.WriteFile(s.dir+"/"+name+".eml", message, 0644)
+}
+
 type YamlEnvelope struct {
 	CC          []string            `yaml:"cc"`
 	BCC         []string            `yaml:"bcc"`
@@ -140,3 +140,15 @@ func (s *smtpSender) Send(e mailer.Envelope) (response string, msgId string, err
 
 	return
 }
+
+// sends already rendered message, the pool is not used since it can only send its own messages
+func (s *smtpSender) SendRaw(from string, to []string, message []byte) (response string, msgId string, err error) {
+	if len(to) == 0 {
+		return "", "", errors.New("no recipients set")
+	}
+	if from == "" {
+		from = s.from.Address
+	}
+	err = smtp.SendMail(s.address, s.auth, from, to, message)
+	return
+}
@@ -0,0 +1,222 @@
+package notif
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Policy decides what happens when a client does not keep up with the messages broadcasted into the channel.
+// each client has its own ordered queue of messages waiting to be received.
+type Policy int
+
+const (
+	// client is disconnected when its queue is full or when it does not receive a message
+	// within the slow consumer timeout.
+	Disconnect Policy = iota
+	// the oldest message in the client's queue is dropped to make space for the new one.
+	DropOldest
+	// the new message is dropped if the client's queue is full.
+	DropNewest
+	// messages which do not fit into the client's full queue wait for it without blocking the channel,
+	// up to another queue size of messages. the client is disconnected once more messages are waiting
+	// or once it has not received any message within the slow consumer timeout while messages are waiting.
+	Block
+)
+
+const DefaultQueueSize = 100
+
+// sets the delivery policy and the size of each client's queue.
+// this has to be called before Start().
+func (ch *Channel) SetDelivery(policy Policy, queueSize int) *Channel {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	ch.policy = policy
+	ch.queueSize = queueSize
+	return ch
+}
+
+// returns number of dropped messages and disconnected slow clients in this channel
+func (ch *Channel) Stats() Stats {
+	return ch.stats.get()
+}
+
+// returns number of dropped messages and disconnected slow clients across all channels in this broker
+func (b *Broker) Stats() Stats {
+	return b.stats.get()
+}
+
+type Stats struct {
+	Drops       uint64
+	Disconnects uint64
+}
+
+type counters struct {
+	drops       uint64
+	disconnects uint64
+}
+
+func (c *counters) get() Stats {
+	return Stats{
+		Drops:       atomic.LoadUint64(&c.drops),
+		Disconnects: atomic.LoadUint64(&c.disconnects),
+	}
+}
+
+// parent can be nil
+func (c *counters) dropped(parent *counters) {
+	atomic.AddUint64(&c.drops, 1)
+	if parent != nil {
+		atomic.AddUint64(&parent.drops, 1)
+	}
+}
+
+// parent can be nil
+func (c *counters) disconnected(parent *counters) {
+	atomic.AddUint64(&c.disconnects, 1)
+	if parent != nil {
+		atomic.AddUint64(&parent.disconnects, 1)
+	}
+}
+
+// puts the message into the client's queue according to the channel's policy.
+// returns false if the client should be disconnected.
+// can be called only from within the loop.
+func (ch *Channel) enqueue(cl *Client, msg *Message) bool {
+	// write-only clients will not handle any messages
+	if cl.queue == nil {
+		return true
+	}
+
+	if ch.policy == Block {
+		return cl.enqueueWaiting(msg, ch.sc)
+	}
+
+	select {
+	case cl.queue <- msg:
+		return true
+	default:
+	}
+
+	switch ch.policy {
+	case DropOldest:
+		for {
+			select {
+			case cl.queue <- msg:
+				return true
+			default:
+			}
+			// the writer may have taken the message meanwhile, in which case there is nothing to drop
+			select {
+			case <-cl.queue:
+				ch.stats.dropped(ch.parentStats)
+			default:
+			}
+		}
+
+	case DropNewest:
+		ch.stats.dropped(ch.parentStats)
+		return true
+
+	default:
+		return false
+	}
+}
+
+// puts the message into the queue or, if it is full, into the overflow where it waits for the client.
+// returns false if the overflow is full or the client has not made any progress within the timeout.
+func (c *Client) enqueueWaiting(msg *Message, timeout time.Duration) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if len(c.overflow) == 0 {
+		select {
+		case c.queue <- msg:
+			return true
+		default:
+		}
+		c.progress = time.Now()
+	} else if len(c.overflow) >= cap(c.queue) || time.Since(c.progress) > timeout {
+		return false
+	}
+	c.overflow = append(c.overflow, msg)
+	return true
+}
+
+// moves waiting messages into the queue once the writer has made space in it
+func (c *Client) refill() {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	for len(c.overflow) > 0 {
+		select {
+		case c.queue <- c.overflow[0]:
+			c.overflow[0] = nil
+			c.overflow = c.overflow[1:]
+			c.progress = time.Now()
+		default:
+			return
+		}
+	}
+	c.overflow = nil
+}
+
+// delivers the missed messages and then messages from the queue, in order, to the client.
+// it is the only sender on the receiving channel so it closes it once the client is closed.
+func (c *Client) write() {
+	defer close(c.recv)
+
+	select {
+	case <-c.ready:
+	case <-c.ctx.Done():
+		return
+	}
+
+	missed := c.missed
+	c.missed = nil
+	for _, msg := range missed {
+		if c.send(msg) == false {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case msg := <-c.queue:
+			if c.ch.policy == Block {
+				c.refill()
+			}
+			if c.send(msg) == false {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) send(msg *Message) bool {
+	var payload interface{} = msg
+	if c.sequenced == false || msg.presence {
+		payload = msg.Payload
+	}
+
+	var timeout <-chan time.Time
+	if c.ch.policy == Disconnect {
+		t := time.NewTimer(c.ch.sc)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-c.ctx.Done():
+		return false
+	case c.recv <- payload:
+		return true
+	case <-timeout:
+		// time out/slow consumer, close the connection
+		c.ch.stats.disconnected(c.ch.parentStats)
+		c.Close()
+		return false
+	}
+}
@@ -0,0 +1,89 @@
+package notif
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBlockDoesNotBlockChannel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the writer holds the first message, the queue the next five and the rest waits in the overflow
+	ch := NewChannel(ctx, "test", 500*time.Millisecond, nil, nil).SetDelivery(Block, 5)
+	go ch.Start()
+
+	slow := ch.Subscribe()
+	fast := ch.Subscribe()
+	writer := ch.Subscribe(true)
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		writer.Broadcast(i)
+	}
+	receive(t, fast, 10)
+	// subscribing goes through the same loop
+	ch.Subscribe().Close()
+	if d := time.Since(start); d > 250*time.Millisecond {
+		t.Fatalf("slow client blocked the channel for %s", d)
+	}
+
+	for k, msg := range receive(t, slow, 10) {
+		if msg != k {
+			t.Fatalf("expected message %d, got %v", k, msg)
+		}
+	}
+	if s := ch.Stats(); s.Drops != 0 || s.Disconnects != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestBlockDisconnectsStuckClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the overflow does not fill up so the client is disconnected by the timeout
+	ch := NewChannel(ctx, "test", 50*time.Millisecond, nil, nil).SetDelivery(Block, 3)
+	go ch.Start()
+
+	stuck := ch.Subscribe()
+	writer := ch.Subscribe(true)
+	for i := 0; i < 5; i++ {
+		writer.Broadcast(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	writer.Broadcast(5)
+
+	select {
+	case <-stuck.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stuck client has not been disconnected")
+	}
+	if s := ch.Stats(); s.Disconnects != 1 {
+		t.Fatalf("expected one disconnect, got %+v", s)
+	}
+}
+
+func TestBlockOverflowIsCapped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := NewChannel(ctx, "test", time.Minute, nil, nil).SetDelivery(Block, 2)
+	go ch.Start()
+
+	stuck := ch.Subscribe()
+	writer := ch.Subscribe(true)
+	for i := 0; i < 10; i++ {
+		writer.Broadcast(i)
+	}
+
+	select {
+	case <-stuck.Done():
+	case <-time.After(time.Second):
+		t.Fatal("client with full overflow has not been disconnected")
+	}
+	if s := ch.Stats(); s.Disconnects != 1 {
+		t.Fatalf("expected one disconnect, got %+v", s)
+	}
+}
@@ -0,0 +1,73 @@
+package notif
+
+import "time"
+
+// history is a ring buffer of last messages broadcasted into a channel.
+// it is not thread-safe, it is meant to be used only from within the channel's loop.
+type history struct {
+	buf    []*Message
+	start  int
+	n      int
+	maxAge time.Duration
+}
+
+func newHistory(size int, maxAge time.Duration) *history {
+	return &history{buf: make([]*Message, size), maxAge: maxAge}
+}
+
+func (h *history) push(msg *Message) {
+	if h.n < len(h.buf) {
+		h.buf[(h.start+h.n)%len(h.buf)] = msg
+		h.n++
+		return
+	}
+	// full, overwrite the oldest message
+	h.buf[h.start] = msg
+	h.start = (h.start + 1) % len(h.buf)
+}
+
+// removes messages older than maxAge
+func (h *history) prune(now time.Time) {
+	if h.maxAge <= 0 {
+		return
+	}
+	for h.n > 0 {
+		if now.Sub(h.buf[h.start].Time) <= h.maxAge {
+			return
+		}
+		h.buf[h.start] = nil
+		h.start = (h.start + 1) % len(h.buf)
+		h.n--
+	}
+}
+
+// returns messages with sequence number greater than seq, in order
+func (h *history) since(seq uint64, now time.Time) []*Message {
+	h.prune(now)
+	var out []*Message
+	for i := 0; i < h.n; i++ {
+		msg := h.buf[(h.start+i)%len(h.buf)]
+		if msg.Seq > seq {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// returns time until the newest message expires or zero if there is nothing
+// to keep or the history does not expire at all.
+// nil history is valid receiver.
+func (h *history) ttl(now time.Time) time.Duration {
+	if h == nil || h.maxAge <= 0 {
+		return 0
+	}
+	h.prune(now)
+	if h.n == 0 {
+		return 0
+	}
+	newest := h.buf[(h.start+h.n-1)%len(h.buf)]
+	if ttl := h.maxAge - now.Sub(newest.Time); ttl > 0 {
+		return ttl
+	}
+	return 0
+}
@@ -13,6 +13,65 @@ type Client struct {
 	o      sync.Once
 	ctx    context.Context
 	cancel context.CancelFunc
+	ready  chan struct{}
+	queue  chan *Message
+	// messages to replay before the live delivery starts, set by the channel's loop before ready is closed
+	missed []*Message
+	id     uint64
+	joined time.Time
+	// following fields are set by subscription options
+	sequenced bool
+	replay    bool
+	since     uint64
+	meta      interface{}
+	presence  bool
+	// messages waiting for space in the queue, used by the Block policy
+	mx       sync.Mutex
+	overflow []*Message
+	progress time.Time
+}
+
+// how long the channel with history is kept alive after its last client leaves, see Channel.Linger()
+const DefaultLinger = time.Minute
+
+// Message is delivered to clients that subscribed with Sequenced() or Since() option
+// instead of the raw broadcasted payload.
+type Message struct {
+	Seq  uint64
+	Time time.Time
+	// name of the channel the message has been broadcasted into.
+	// it differs from the subscribed channel's name if the client subscribed to a pattern.
+	Channel string
+	Payload interface{}
+	// presence events are delivered as raw payload
+	presence bool
+}
+
+type SubscribeOption func(c *Client)
+
+// client will not receive any messages and will not be disconnected for being slow reader.
+func WriteOnly() SubscribeOption {
+	return func(c *Client) {
+		c.recv = nil
+	}
+}
+
+// client will receive *Message instead of the raw payload so it knows the sequence number of each message.
+func Sequenced() SubscribeOption {
+	return func(c *Client) {
+		c.sequenced = true
+	}
+}
+
+// client will first receive all messages from the channel's history with sequence number greater than seq,
+// in order, before the live delivery starts. implies Sequenced().
+// channel without history will not replay anything.
+func Since(seq uint64) SubscribeOption {
+	return func(c *Client) {
+		c.sequenced = true
+		c.replay = true
+		c.since = seq
+	}
 }
 
 // will be nil if this client is write-only
@@ -31,28 +90,9 @@ func (c *Client) Done() <-chan struct{} {
 	return c.ctx.Done()
 }
 
+// receiving channel is closed by the client's writer once the context is cancelled
 func (c *Client) doClose() {
-	c.o.Do(func() {
-		c.cancel()
-		if c.recv != nil {
-			close(c.recv)
-		}
-	})
-}
-
-func (c *Client) send(msg interface{}) {
-	// write-only clients will not handle any messages
-	if c.recv == nil {
-		return
-	}
-	t := time.NewTimer(c.ch.sc)
-	select {
-	case <-c.ctx.Done():
-	case c.recv <- msg:
-	case <-t.C:
-		// time out/slow consumer, close the connection
-		c.Close()
-	}
+	c.o.Do(c.cancel)
 }
 
 func (c *Client) Broadcast(payload interface{}) bool {
@@ -70,6 +110,19 @@ type envelope struct {
 	Sender  uintptr
 }
 
+// message forwarded from a concrete channel into a matching pattern channel
+type forwarded struct {
+	Message interface{}
+	Channel string
+}
+
+// (un)links pattern channel to concrete channel. it is sent via ingres so any message broadcasted
+// after the pattern has been subscribed to will be forwarded.
+type linkRequest struct {
+	pattern *Channel
+	unlink  bool
+}
+
 // leech is channel-blocking so goroutine should be called internally to make it non-blocking
 // this is to ensure proper order of leeched messages.
 func NewChannel(ctx context.Context, name string, slowConsumer time.Duration, emptyCh chan string, leech func(interface{})) *Channel {
@@ -84,6 +137,12 @@ func NewChannel(ctx context.Context, name string, slowConsumer time.Duration, em
 		empty:       emptyCh,
 		leech:       leech,
 		counter:     make(chan chan<- int, 10),
+		members:     make(chan chan<- []Member, 10),
+		links:       make(map[*Channel]struct{}),
+		policy:      Disconnect,
+		lingerFor:   DefaultLinger,
+		queueSize:   DefaultQueueSize,
+		stats:       new(counters),
 	}
 }
 
@@ -98,23 +157,82 @@ type Channel struct {
 	empty       chan string
 	leech       func(interface{})
 	counter     chan chan<- int
+	members     chan chan<- []Member
+	seq         uint64
+	history     *history
+	links       map[*Channel]struct{}
+	policy      Policy
+	queueSize   int
+	stats       *counters
+	// broker's counters, if the channel is brokered
+	parentStats *counters
+	// delays the empty signal while there is history to replay
+	linger    *time.Timer
+	lingerFor time.Duration
+	// clients removed while announcing the leave of other client, see remove()
+	leaving []*Client
 }
 
 func (ch *Channel) Id() string {
 	return ch.name
 }
 
+// enables history of last "size" messages which are not older than "maxAge", if it is greater than zero.
+// history is used to replay missed messages to clients subscribed with the Since() option.
+// channel with history will signal it is empty only after all messages in the history have expired,
+// or after the linger period if the history does not expire, so the clients have a chance to reconnect.
+// this has to be called before Start().
+func (ch *Channel) KeepHistory(size int, maxAge time.Duration) *Channel {
+	if size > 0 {
+		ch.history = newHistory(size, maxAge)
+	} else {
+		ch.history = nil
+	}
+	return ch
+}
+
+// sets how long the channel with history, which does not expire, is kept alive after its last client leaves,
+// defaults to DefaultLinger. the sequence numbers restart once the channel is gone.
+// this has to be called before Start().
+func (ch *Channel) Linger(d time.Duration) *Channel {
+	ch.lingerFor = d
+	return ch
+}
+
 // subscription is read-write by default. by providing "writeOnly=true", it can be switched into write-only mode
 // in which case the client will not be disconnected for being slow reader.
 func (ch *Channel) Subscribe(writeOnly ...bool) *Client {
+	if len(writeOnly) > 0 && writeOnly[0] {
+		return ch.SubscribeWith(WriteOnly())
+	}
+	return ch.SubscribeWith()
+}
+
+// the same as Subscribe() but the subscription is configured by the options, ie. Since() to replay missed messages.
+// messages are delivered in order according to the channel's delivery policy, see SetDelivery().
+func (ch *Channel) SubscribeWith(opts ...SubscribeOption) *Client {
 	c := &Client{
-		ch: ch,
+		ch:    ch,
+		recv:  make(chan interface{}),
+		ready: make(chan struct{}),
+		id:    nextClientId(),
 	}
-	if len(writeOnly) == 0 || writeOnly[0] == false {
-		c.recv = make(chan interface{})
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
 	}
 	c.ctx, c.cancel = context.WithCancel(ch.ctx)
+	if c.recv != nil {
+		c.queue = make(chan *Message, ch.queueSize)
+		go c.write()
+	}
 	ch.subscribe <- c
+	// wait for the channel to register the client so it will not miss any message broadcasted after this call
+	select {
+	case <-c.ready:
+	case <-c.ctx.Done():
+	}
 	return c
 }
 
@@ -124,7 +242,14 @@ func (ch *Channel) Broadcast() chan<- interface{} {
 
 // returns once context is cancelled
 func (ch *Channel) Start() {
+	defer ch.stopLinger()
+
 	for {
+		var lingerCh <-chan time.Time
+		if ch.linger != nil {
+			lingerCh = ch.linger.C
+		}
+
 		select {
 		case <-ch.ctx.Done():
 			for cl := range ch.aud {
@@ -133,35 +258,141 @@ func (ch *Channel) Start() {
 			}
 			return
 		case cl := <-ch.subscribe:
+			ch.stopLinger()
+			cl.joined = time.Now()
 			ch.aud[cl] = struct{}{}
+			if cl.replay && cl.recv != nil && ch.history != nil {
+				cl.missed = ch.history.since(cl.since, cl.joined)
+			}
+			close(cl.ready)
+			ch.announce(Join, cl)
 
 		case cl := <-ch.unsubscribe:
-			delete(ch.aud, cl)
-			cl.doClose()
+			ch.remove(cl)
+
+		case <-lingerCh:
+			ch.linger = nil
 			if len(ch.aud) == 0 {
 				ch.signalEmpty()
 			}
 
 		case msg := <-ch.ingres:
+			if link, ok := msg.(*linkRequest); ok {
+				if link.unlink {
+					delete(ch.links, link.pattern)
+				} else {
+					ch.links[link.pattern] = struct{}{}
+				}
+				continue
+			}
+			origin := ch.name
+			f, fwd := msg.(*forwarded)
+			if fwd {
+				msg = f.Message
+				origin = f.Channel
+			}
 			e, ok := msg.(*envelope)
 			if ok {
 				msg = e.Message
 			}
-			for cl := range ch.aud {
-				if ok == false || uintptr(unsafe.Pointer(cl)) != e.Sender {
-					go cl.send(e.Message)
-				}
+			ch.seq++
+			m := &Message{Seq: ch.seq, Time: time.Now(), Channel: origin, Payload: msg}
+			if ch.history != nil {
+				ch.history.push(m)
 			}
-			if ch.leech != nil {
+			ch.deliver(m, func(cl *Client) bool {
+				return ok == false || uintptr(unsafe.Pointer(cl)) != e.Sender
+			})
+			// forwarded messages have already been leeched by the channel they were broadcasted into
+			if ch.leech != nil && fwd == false {
 				ch.leech(msg)
 			}
+			for pattern := range ch.links {
+				select {
+				case <-pattern.ctx.Done():
+				case pattern.ingres <- &forwarded{Message: msg, Channel: origin}:
+				}
+			}
 
 		case count := <-ch.counter:
 			count <- len(ch.aud)
+
+		case req := <-ch.members:
+			members := make([]Member, 0, len(ch.aud))
+			for cl := range ch.aud {
+				members = append(members, cl.member())
+			}
+			req <- members
+		}
+	}
+}
+
+// enqueues the message for all clients accepted by the filter and disconnects those that cannot receive it.
+// can be called only from within the loop.
+func (ch *Channel) deliver(msg *Message, filter func(cl *Client) bool) {
+	var failed []*Client
+	for cl := range ch.aud {
+		if filter(cl) && ch.enqueue(cl, msg) == false {
+			failed = append(failed, cl)
+		}
+	}
+	for _, cl := range failed {
+		ch.stats.disconnected(ch.parentStats)
+		ch.remove(cl)
+	}
+}
+
+// removes the client from the audience and closes it.
+// can be called only from within the loop.
+func (ch *Channel) remove(cl *Client) {
+	if _, ok := ch.aud[cl]; ok == false {
+		return
+	}
+	delete(ch.aud, cl)
+	cl.doClose()
+
+	// announcing the leave can disconnect other clients, which are announced by the outermost call
+	// so the empty channel is handled only once
+	ch.leaving = append(ch.leaving, cl)
+	if len(ch.leaving) > 1 {
+		return
+	}
+	for k := 0; k < len(ch.leaving); k++ {
+		ch.announce(Leave, ch.leaving[k])
+	}
+	ch.leaving = ch.leaving[:0]
+
+	if len(ch.aud) == 0 {
+		ch.stopLinger()
+		if ttl := ch.lingerTime(time.Now()); ttl > 0 {
+			ch.linger = time.NewTimer(ttl)
+		} else {
+			ch.signalEmpty()
 		}
 	}
 }
 
+// how long the empty channel should be kept alive so its history can be replayed
+func (ch *Channel) lingerTime(now time.Time) time.Duration {
+	if ch.history == nil {
+		return 0
+	}
+	if ch.history.maxAge > 0 {
+		return ch.history.ttl(now)
+	}
+	if ch.history.n == 0 {
+		return 0
+	}
+	return ch.lingerFor
+}
+
+func (ch *Channel) stopLinger() {
+	if ch.linger != nil {
+		ch.linger.Stop()
+		ch.linger = nil
+	}
+}
+
 // returns number of clients in this channel
 func (ch *Channel) Count() int {
 	req := make(chan int)
@@ -190,7 +421,7 @@ func (ch *Channel) signalEmpty() {
 type subscribeRequest struct {
 	name string
 	recv chan *Client
-	wo   bool
+	opts []SubscribeOption
 }
 
 type broadcastRequest struct {
@@ -203,9 +434,16 @@ type hasRequest struct {
 	recv chan bool
 }
 
+// empty name lists all channels
+type listRequest struct {
+	name string
+	recv chan []*Channel
+}
+
 type brokeredChannel struct {
-	ch     *Channel
-	cancel context.CancelFunc
+	ch      *Channel
+	cancel  context.CancelFunc
+	pattern bool
 }
 
 type brokerLeech interface {
@@ -223,6 +461,8 @@ func NewBroker(ctx context.Context, slowConsumer time.Duration, leech brokerLeec
 		leech:     leech,
 		counter:   make(chan chan<- int, 10),
 		has:       make(chan hasRequest, 10),
+		lists:     make(chan listRequest, 10),
+		stats:     new(counters),
 	}
 }
 
@@ -236,6 +476,17 @@ type Broker struct {
 	leech     brokerLeech
 	counter   chan chan<- int
 	has       chan hasRequest
+	lists     chan listRequest
+	configure func(ch *Channel)
+	stats     *counters
+}
+
+// configure is called for every new channel created by the broker before it is started
+// so per-channel features, like history, can be enabled based on the channel's name.
+// this has to be called before Start().
+func (b *Broker) Configure(configure func(ch *Channel)) *Broker {
+	b.configure = configure
+	return b
 }
 
 // returns once context is cancelled
@@ -245,43 +496,26 @@ func (b *Broker) Start() {
 		case <-b.ctx.Done():
 			return
 		case req := <-b.subscribe:
-			ch, ok := b.chans[req.name]
-			if ok == false {
-				ctx, cancel := context.WithCancel(b.ctx)
-				var l func(interface{})
-				if b.leech != nil {
-					l = b.leech.Match(req.name)
-				}
-				ch = &brokeredChannel{
-					ch:     NewChannel(ctx, req.name, b.sc, b.empty, l),
-					cancel: cancel,
-				}
-				b.chans[req.name] = ch
-				go ch.ch.Start()
-			}
-			req.recv <- ch.ch.Subscribe(req.wo)
+			// the handshake waits for the channel's loop, which can be busy delivering,
+			// so it must not block the other channels
+			go func(ch *Channel, req *subscribeRequest) {
+				req.recv <- ch.SubscribeWith(req.opts...)
+			}(b.channel(req.name), req)
 
 		case req := <-b.broadcast:
-			ch, ok := b.chans[req.name]
-			if ok == false {
-				ctx, cancel := context.WithCancel(b.ctx)
-				var l func(interface{})
-				if b.leech != nil {
-					l = b.leech.Match(req.name)
-				}
-				ch = &brokeredChannel{
-					ch:     NewChannel(ctx, req.name, b.sc, b.empty, l),
-					cancel: cancel,
-				}
-				b.chans[req.name] = ch
-				go ch.ch.Start()
-			}
-			req.recv <- ch.ch
+			req.recv <- b.channel(req.name)
 
 		case name := <-b.empty:
 			if ch, ok := b.chans[name]; ok {
 				ch.cancel()
 				delete(b.chans, name)
+				if ch.pattern {
+					for other, c := range b.chans {
+						if c.pattern == false && MatchName(name, other) {
+							c.ch.ingres <- &linkRequest{pattern: ch.ch, unlink: true}
+						}
+					}
+				}
 			}
 
 		case count := <-b.counter:
@@ -290,17 +524,75 @@ func (b *Broker) Start() {
 		case has := <-b.has:
 			_, ok := b.chans[has.name]
 			has.recv <- ok
+
+		case req := <-b.lists:
+			var chans []*Channel
+			if req.name != "" {
+				if ch, ok := b.chans[req.name]; ok {
+					chans = append(chans, ch.ch)
+				}
+			} else {
+				chans = make([]*Channel, 0, len(b.chans))
+				for _, ch := range b.chans {
+					chans = append(chans, ch.ch)
+				}
+			}
+			req.recv <- chans
 		}
 	}
 }
 
+// returns existing channel or creates and starts a new one
+func (b *Broker) channel(name string) *Channel {
+	ch, ok := b.chans[name]
+	if ok == false {
+		ctx, cancel := context.WithCancel(b.ctx)
+		var l func(interface{})
+		if b.leech != nil {
+			l = b.leech.Match(name)
+		}
+		ch = &brokeredChannel{
+			ch:      NewChannel(ctx, name, b.sc, b.empty, l),
+			cancel:  cancel,
+			pattern: IsPattern(name),
+		}
+		ch.ch.parentStats = b.stats
+		if b.configure != nil {
+			b.configure(ch.ch)
+		}
+		// link concrete channels with patterns matching them so that the concrete channels
+		// can forward their messages to pattern's subscribers.
+		for other, c := range b.chans {
+			if ch.pattern && c.pattern == false && MatchName(name, other) {
+				c.ch.ingres <- &linkRequest{pattern: ch.ch}
+			} else if ch.pattern == false && c.pattern && MatchName(other, name) {
+				ch.ch.links[c.ch] = struct{}{}
+			}
+		}
+		b.chans[name] = ch
+		go ch.ch.Start()
+	}
+	return ch.ch
+}
+
 // subscription is read-write by default. by providing "writeOnly=true", it can be switched into write-only mode
 // in which case the client will not be disconnected for being slow reader.
 func (b *Broker) Subscribe(name string, writeOnly ...bool) *Client {
+	if len(writeOnly) > 0 && writeOnly[0] {
+		return b.SubscribeWith(name, WriteOnly())
+	}
+	return b.SubscribeWith(name)
+}
+
+// the same as Subscribe() but the subscription is configured by the options.
+// name can be a pattern, see MatchName(), in which case the client will receive messages broadcasted into
+// all matching channels. messages broadcasted by clients subscribed to a pattern are delivered only to
+// the other subscribers of the same pattern.
+func (b *Broker) SubscribeWith(name string, opts ...SubscribeOption) *Client {
 	req := &subscribeRequest{
 		name: name,
 		recv: make(chan *Client),
-		wo:   len(writeOnly) > 0 && writeOnly[0] == true,
+		opts: opts,
 	}
 	b.subscribe <- req
 	c := <-req.recv
@@ -337,3 +629,11 @@ func (b *Broker) Has(name string) bool {
 	close(req.recv)
 	return has
 }
+
+func (b *Broker) list(name string) []*Channel {
+	req := listRequest{name: name, recv: make(chan []*Channel)}
+	b.lists <- req
+	chans := <-req.recv
+	close(req.recv)
+	return chans
+}
@@ -0,0 +1,175 @@
+package notif
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func seqs(msgs []*Message) []uint64 {
+	out := make([]uint64, len(msgs))
+	for k := range msgs {
+		out[k] = msgs[k].Seq
+	}
+	return out
+}
+
+func equalSeqs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// receives n messages or fails after a second
+func receive(t *testing.T, c *Client, n int) []interface{} {
+	t.Helper()
+	var out []interface{}
+	for len(out) < n {
+		select {
+		case msg, ok := <-c.Listen():
+			if ok == false {
+				t.Fatalf("client closed after %d messages", len(out))
+			}
+			out = append(out, msg)
+		case <-time.After(time.Second):
+			t.Fatalf("received %d messages, expected %d", len(out), n)
+		}
+	}
+	return out
+}
+
+func TestHistory(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name   string
+		size   int
+		maxAge time.Duration
+		// ages of pushed messages
+		pushed []time.Duration
+		since  uint64
+		expect []uint64
+	}{
+		{"all", 5, 0, []time.Duration{0, 0, 0}, 0, []uint64{1, 2, 3}},
+		{"since", 5, 0, []time.Duration{0, 0, 0}, 2, []uint64{3}},
+		{"nothing missed", 5, 0, []time.Duration{0, 0, 0}, 3, nil},
+		{"ring", 3, 0, []time.Duration{0, 0, 0, 0, 0}, 0, []uint64{3, 4, 5}},
+		{"expired", 5, time.Minute, []time.Duration{2 * time.Minute, 2 * time.Minute, 0}, 0, []uint64{3}},
+	}
+
+	for _, c := range cases {
+		h := newHistory(c.size, c.maxAge)
+		for k, age := range c.pushed {
+			h.push(&Message{Seq: uint64(k + 1), Time: now.Add(-age)})
+		}
+		if got := seqs(h.since(c.since, now)); equalSeqs(got, c.expect) == false {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expect, got)
+		}
+	}
+}
+
+func TestSubscribeSince(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := NewChannel(ctx, "test", time.Second, nil, nil).KeepHistory(10, 0)
+	go ch.Start()
+
+	writer := ch.Subscribe(true)
+	if writer.Listen() != nil {
+		t.Fatal("write-only client has receiving channel")
+	}
+
+	first := ch.SubscribeWith(Sequenced())
+	for i := 0; i < 3; i++ {
+		writer.Broadcast(i)
+	}
+	msgs := receive(t, first, 3)
+	last := msgs[1].(*Message).Seq
+
+	late := ch.SubscribeWith(Since(last))
+	replayed := receive(t, late, 1)
+	if m := replayed[0].(*Message); m.Seq != 3 || m.Payload != 2 {
+		t.Fatalf("unexpected replayed message %+v", m)
+	}
+}
+
+func TestBrokerKeepsHistoryOfEmptyChannel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := NewBroker(ctx, time.Second, nil).Configure(func(ch *Channel) {
+		ch.KeepHistory(10, 0).Linger(time.Second)
+	})
+	go b.Start()
+
+	c := b.SubscribeWith("test", Sequenced())
+	b.Broadcast("test") <- "a"
+	b.Broadcast("test") <- "b"
+	seq := receive(t, c, 2)[0].(*Message).Seq
+	c.Close()
+	<-c.Done()
+
+	// the lone client reconnects after it has left
+	c = b.SubscribeWith("test", Since(seq))
+	defer c.Close()
+	if m := receive(t, c, 1)[0].(*Message); m.Payload != "b" {
+		t.Fatalf("expected missed message to be replayed, got %+v", m)
+	}
+}
+
+func TestBrokerRemovesEmptyChannelAfterLinger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := NewBroker(ctx, time.Second, nil).Configure(func(ch *Channel) {
+		ch.KeepHistory(10, 0).Linger(50 * time.Millisecond)
+	})
+	go b.Start()
+
+	c := b.Subscribe("test")
+	b.Broadcast("test") <- "a"
+	receive(t, c, 1)
+	c.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for b.Has("test") {
+		if time.Now().After(deadline) {
+			t.Fatal("empty channel has not been removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRemoveDuringLeaveAnnouncement(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	empty := make(chan string, 2)
+	ch := NewChannel(ctx, "test", 5*time.Second, empty, nil).SetDelivery(Disconnect, 1)
+	go ch.Start()
+
+	// the watcher does not read so its queue gets full and the leave announcement disconnects it
+	watcher := ch.SubscribeWith(Presence())
+	leaving := ch.Subscribe(true)
+	// the watcher's writer takes the join announcement and waits for the watcher to read it
+	time.Sleep(20 * time.Millisecond)
+	ch.Broadcast() <- "a"
+	time.Sleep(20 * time.Millisecond)
+	leaving.Close()
+
+	select {
+	case <-watcher.Done():
+	case <-time.After(time.Second):
+		t.Fatal("watcher has not been disconnected")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := len(empty); n != 1 {
+		t.Fatalf("expected single empty signal, got %d", n)
+	}
+}
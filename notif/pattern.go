@@ -0,0 +1,47 @@
+package notif
+
+import "strings"
+
+const (
+	// separates tokens of hierarchical channel names, ie. "orders.eu.created"
+	TokenSeparator = "."
+	// matches exactly one token, ie. "orders.*.created"
+	WildcardToken = "*"
+	// matches one or more trailing tokens, ie. "orders.>", it can be used only as the last token
+	WildcardTail = ">"
+)
+
+// returns true if the name contains wildcard tokens
+func IsPattern(name string) bool {
+	for _, token := range strings.Split(name, TokenSeparator) {
+		if token == WildcardToken || token == WildcardTail {
+			return true
+		}
+	}
+	return false
+}
+
+// returns true if the channel name matches the pattern.
+// pattern without wildcards matches only the same name.
+func MatchName(pattern, name string) bool {
+	if pattern == name {
+		return true
+	}
+
+	p := strings.Split(pattern, TokenSeparator)
+	n := strings.Split(name, TokenSeparator)
+
+	for k := range p {
+		if p[k] == WildcardTail {
+			return k == len(p)-1 && len(n) > k
+		}
+		if k >= len(n) {
+			return false
+		}
+		if p[k] != WildcardToken && p[k] != n[k] {
+			return false
+		}
+	}
+
+	return len(p) == len(n)
+}
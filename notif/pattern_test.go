@@ -0,0 +1,118 @@
+package notif
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMatchName(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"orders", "orders", true},
+		{"orders", "orders.eu", false},
+		{"orders.*", "orders.eu", true},
+		{"orders.*", "orders.eu.created", false},
+		{"orders.*.created", "orders.eu.created", true},
+		{"orders.>", "orders.eu.created", true},
+		{"orders.>", "orders", false},
+		{"orders.>.created", "orders.eu.created", false},
+		{"*", "orders", true},
+		{">", "orders.eu", true},
+	}
+
+	for _, c := range cases {
+		if MatchName(c.pattern, c.name) != c.match {
+			t.Errorf("pattern '%s' and name '%s' expected match to be %v", c.pattern, c.name, c.match)
+		}
+		if IsPattern(c.pattern) != (c.pattern != "orders") {
+			t.Errorf("pattern '%s' is not recognized", c.pattern)
+		}
+	}
+}
+
+func TestBrokerPatternSubscription(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := NewBroker(ctx, time.Second, nil)
+	go b.Start()
+
+	cases := []struct {
+		name     string
+		received bool
+	}{
+		{"orders.eu.created", true},
+		{"orders.us.created", true},
+		{"orders.eu.deleted", false},
+		{"users.eu.created", false},
+	}
+
+	// concrete channel created before the pattern
+	before := b.Subscribe(cases[0].name)
+	defer before.Close()
+
+	pattern := b.SubscribeWith("orders.*.created", Sequenced())
+	defer pattern.Close()
+
+	for _, c := range cases {
+		b.Broadcast(c.name) <- c.name
+	}
+
+	var got []string
+	for _, msg := range receive(t, pattern, 2) {
+		got = append(got, msg.(*Message).Channel)
+	}
+	for _, c := range cases {
+		found := false
+		for _, name := range got {
+			found = found || name == c.name
+		}
+		if found != c.received {
+			t.Errorf("%s: expected received to be %v", c.name, c.received)
+		}
+	}
+}
+
+func TestBrokerSubscribeDoesNotWaitForBusyChannel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := NewBroker(ctx, 5*time.Second, nil).Configure(func(ch *Channel) {
+		if ch.Id() == "busy" {
+			ch.SetDelivery(Block, 1)
+		}
+	})
+	go b.Start()
+
+	// the client never reads so the busy channel's delivery is stuck
+	slow := b.Subscribe("busy")
+	defer slow.Close()
+	for i := 0; i < 5; i++ {
+		b.Broadcast("busy") <- i
+	}
+
+	// this handshake waits until the busy channel gets to it
+	go func() {
+		if c := b.Subscribe("busy"); c != nil {
+			c.Close()
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		c := b.Subscribe("other")
+		c.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscription to other channel has been blocked by busy channel")
+	}
+}
@@ -0,0 +1,116 @@
+package notif
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type PresenceType int
+
+const (
+	Join PresenceType = iota
+	Leave
+)
+
+// PresenceEvent is delivered, as is, to clients subscribed with the Presence() option
+// when other client joins or leaves the channel.
+type PresenceEvent struct {
+	Type    PresenceType
+	Channel string
+	Member  Member
+}
+
+type Member struct {
+	Id     uint64
+	Meta   interface{}
+	Joined time.Time
+}
+
+// unique across all channels and brokers
+var lastClientId uint64
+
+func nextClientId() uint64 {
+	return atomic.AddUint64(&lastClientId, 1)
+}
+
+// attaches metadata, ie. user id and device, to the client which other clients can see via Members()
+// or presence events.
+func WithMeta(meta interface{}) SubscribeOption {
+	return func(c *Client) {
+		c.meta = meta
+	}
+}
+
+// client will receive *PresenceEvent when other client joins or leaves the channel.
+// events are delivered in order with the messages but they are not part of the history and
+// they do not have sequence numbers.
+func Presence() SubscribeOption {
+	return func(c *Client) {
+		c.presence = true
+	}
+}
+
+func (c *Client) Id() uint64 {
+	return c.id
+}
+
+func (c *Client) Meta() interface{} {
+	return c.meta
+}
+
+func (c *Client) member() Member {
+	return Member{Id: c.id, Meta: c.meta, Joined: c.joined}
+}
+
+// returns all clients in this channel.
+// returns nil if the channel has been stopped.
+func (ch *Channel) Members() []Member {
+	req := make(chan []Member, 1)
+	select {
+	case <-ch.ctx.Done():
+		return nil
+	case ch.members <- req:
+	}
+	select {
+	case <-ch.ctx.Done():
+		return nil
+	case m := <-req:
+		return m
+	}
+}
+
+// delivers presence event to other clients that want it.
+// can be called only from within the loop.
+func (ch *Channel) announce(t PresenceType, cl *Client) {
+	msg := &Message{
+		Time:     time.Now(),
+		Channel:  ch.name,
+		Payload:  &PresenceEvent{Type: t, Channel: ch.name, Member: cl.member()},
+		presence: true,
+	}
+	ch.deliver(msg, func(other *Client) bool {
+		return other != cl && other.presence
+	})
+}
+
+// returns all clients in the channel with provided name, or nil if there is no such channel.
+func (b *Broker) Members(name string) []Member {
+	chans := b.list(name)
+	if len(chans) == 0 {
+		return nil
+	}
+	return chans[0].Members()
+}
+
+// returns clients of all channels in this broker, by channel name.
+// each channel is queried by its own loop so the result is not an atomic snapshot of the whole broker.
+func (b *Broker) Presence() map[string][]Member {
+	chans := b.list("")
+	out := make(map[string][]Member, len(chans))
+	for _, ch := range chans {
+		if members := ch.Members(); len(members) > 0 {
+			out[ch.Id()] = members
+		}
+	}
+	return out
+}
@@ -0,0 +1,244 @@
+package sse_hub
+
+import (
+	"errors"
+	"github.com/ivanjaros/ijlibs/notif"
+	"github.com/ivanjaros/ijlibs/sse_stream"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resolves names of the broker's channels, or patterns, the request should be subscribed to.
+// returned error is sent to the client with 400 status code.
+type Resolver func(r *http.Request) ([]string, error)
+
+// converts the message into the server-sent event. the ID of the event is always set by the hub.
+type Encoder func(msg *notif.Message) *sse_stream.Message
+
+func New(broker *notif.Broker, resolver Resolver, heartbeat time.Duration) *Hub {
+	return &Hub{
+		broker:    broker,
+		resolver:  resolver,
+		heartbeat: heartbeat,
+		encoder:   defaultEncoder,
+	}
+}
+
+// Hub is http.Handler which streams messages from the broker's channels as server-sent events.
+// id of each event is a cursor of all subscribed channels so the client can resume the stream
+// via Last-Event-ID header, provided the channels keep history, see notif.Channel.KeepHistory().
+type Hub struct {
+	broker    *notif.Broker
+	resolver  Resolver
+	heartbeat time.Duration
+	retry     time.Duration
+	encoder   Encoder
+}
+
+func defaultEncoder(msg *notif.Message) *sse_stream.Message {
+	return &sse_stream.Message{Data: msg.Payload}
+}
+
+// by default, the event has no name and the payload is sent as its data.
+func (h *Hub) SetEncoder(enc Encoder) *Hub {
+	if enc == nil {
+		enc = defaultEncoder
+	}
+	h.encoder = enc
+	return h
+}
+
+// sets the reconnection time sent to the client once the stream starts
+func (h *Hub) SetRetry(retry time.Duration) *Hub {
+	h.retry = retry
+	return h
+}
+
+type received struct {
+	channel string
+	msg     *notif.Message
+	ok      bool
+}
+
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if ok == false {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	names, err := h.resolver(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(names) == 0 {
+		http.Error(w, "no channel to subscribe to", http.StatusBadRequest)
+		return
+	}
+
+	lastId := r.Header.Get("Last-Event-ID")
+	cur, err := parseCursor(lastId, names)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	recv := make(chan received)
+	clients := make([]*notif.Client, 0, len(names))
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+
+	for _, name := range names {
+		var c *notif.Client
+		if seq, ok := cur[name]; ok {
+			c = h.broker.SubscribeWith(name, notif.Since(seq))
+		} else if lastId != "" {
+			// resuming client has not received anything from this channel yet so it gets its whole history
+			c = h.broker.SubscribeWith(name, notif.Since(0))
+		} else {
+			c = h.broker.SubscribeWith(name, notif.Sequenced())
+		}
+		clients = append(clients, c)
+
+		go func(name string, c *notif.Client) {
+			for {
+				v, ok := <-c.Listen()
+				msg, _ := v.(*notif.Message)
+				select {
+				case <-ctx.Done():
+					return
+				case recv <- received{channel: name, msg: msg, ok: ok}:
+				}
+				if ok == false {
+					return
+				}
+			}
+		}(name, c)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if h.retry > 0 {
+		if err := (&sse_stream.Message{Retry: h.retry}).Encode(w); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	var heartbeat <-chan time.Time
+	if h.heartbeat > 0 {
+		t := time.NewTicker(h.heartbeat)
+		defer t.Stop()
+		heartbeat = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-heartbeat:
+			// comment line is ignored by the client but it keeps the connection and proxies alive
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case rc := <-recv:
+			// client has been disconnected by the channel, ie. for being slow, so we end the stream
+			// and let the client reconnect and resume from the last event it has received.
+			if rc.ok == false {
+				return
+			}
+			if rc.msg == nil {
+				continue
+			}
+			cur[rc.channel] = rc.msg.Seq
+			e := h.encoder(rc.msg)
+			if e == nil {
+				continue
+			}
+			e.ID = cur.String(names)
+			if err := e.Encode(w); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// last received sequence number per subscribed channel
+type cursor map[string]uint64
+
+// single channel is encoded as plain sequence number, multiple channels as url-encoded
+// channel=sequence pairs.
+func (c cursor) String(names []string) string {
+	if len(names) == 1 {
+		if seq, ok := c[names[0]]; ok {
+			return strconv.FormatUint(seq, 10)
+		}
+		return ""
+	}
+
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		if sb.Len() > 0 {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(url.QueryEscape(k))
+		sb.WriteByte('=')
+		sb.WriteString(strconv.FormatUint(c[k], 10))
+	}
+	return sb.String()
+}
+
+// channels which are not in the names are ignored so the client can change its subscriptions
+func parseCursor(id string, names []string) (cursor, error) {
+	cur := make(cursor, len(names))
+	if id == "" {
+		return cur, nil
+	}
+
+	if len(names) == 1 && strings.Contains(id, "=") == false {
+		seq, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid last event id")
+		}
+		cur[names[0]] = seq
+		return cur, nil
+	}
+
+	values, err := url.ParseQuery(id)
+	if err != nil {
+		return nil, errors.New("invalid last event id")
+	}
+	for _, name := range names {
+		if v := values.Get(name); v != "" {
+			seq, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return nil, errors.New("invalid last event id")
+			}
+			cur[name] = seq
+		}
+	}
+	return cur, nil
+}
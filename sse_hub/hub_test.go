@@ -0,0 +1,148 @@
+package sse_hub
+
+import (
+	"bufio"
+	"context"
+	"github.com/ivanjaros/ijlibs/notif"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newServer(t *testing.T) (*notif.Broker, *httptest.Server) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	broker := notif.NewBroker(ctx, time.Second, nil).Configure(func(ch *notif.Channel) {
+		ch.KeepHistory(10, 0)
+	})
+	go broker.Start()
+
+	hub := New(broker, func(r *http.Request) ([]string, error) {
+		return r.URL.Query()["channel"], nil
+	}, 0).SetRetry(time.Second)
+
+	srv := httptest.NewServer(hub)
+	t.Cleanup(srv.Close)
+	return broker, srv
+}
+
+func connect(t *testing.T, url, lastId string) *bufio.Reader {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastId != "" {
+		req.Header.Set("Last-Event-ID", lastId)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+
+	r := bufio.NewReader(res.Body)
+	// the stream starts with the retry, once the subscriptions are in place
+	if e := readEvent(t, r); e["retry"] != "1000" {
+		t.Fatalf("expected retry, got %v", e)
+	}
+	return r
+}
+
+// reads single event as field-value pairs
+func readEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+	e := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return e
+		}
+		if k := strings.Index(line, ": "); k > -1 {
+			e[line[:k]] = line[k+2:]
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	broker, srv := newServer(t)
+	r := connect(t, srv.URL+"?channel=a&channel=b", "")
+
+	broker.Broadcast("a") <- "first"
+	if e := readEvent(t, r); e["id"] != "a=1" || e["data"] != `"first"` {
+		t.Fatalf("unexpected event %v", e)
+	}
+	broker.Broadcast("b") <- "second"
+	if e := readEvent(t, r); e["id"] != "a=1&b=1" || e["data"] != `"second"` {
+		t.Fatalf("unexpected event %v", e)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	broker, srv := newServer(t)
+	// messages still queued in the channel are delivered live, after the replayed ones
+	for _, v := range []string{"a", "b", "c", "d"} {
+		broker.Broadcast("test") <- v
+	}
+
+	r := connect(t, srv.URL+"?channel=test", "2")
+	for _, expect := range []map[string]string{{"id": "3", "data": `"c"`}, {"id": "4", "data": `"d"`}} {
+		if e := readEvent(t, r); e["id"] != expect["id"] || e["data"] != expect["data"] {
+			t.Fatalf("expected %v, got %v", expect, e)
+		}
+	}
+}
+
+func TestReplayMissingChannel(t *testing.T) {
+	broker, srv := newServer(t)
+	broker.Broadcast("a") <- "first"
+	broker.Broadcast("b") <- "second"
+
+	// the client has seen the first message of a but nothing of b, which it has to get from the start
+	r := connect(t, srv.URL+"?channel=a&channel=b", "a=1")
+	if e := readEvent(t, r); e["id"] != "a=1&b=1" || e["data"] != `"second"` {
+		t.Fatalf("unexpected event %v", e)
+	}
+}
+
+func TestInvalidLastEventId(t *testing.T) {
+	_, srv := newServer(t)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"?channel=test", nil)
+	req.Header.Set("Last-Event-ID", "nope")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d", res.StatusCode)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	names := []string{"b", "a c"}
+	cur, err := parseCursor("a+c=3&b=7&other=1", names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cur) != 2 || cur["a c"] != 3 || cur["b"] != 7 {
+		t.Fatalf("unexpected cursor %v", cur)
+	}
+	if s := cur.String(names); s != "a+c=3&b=7" {
+		t.Fatalf("unexpected id %s", s)
+	}
+}
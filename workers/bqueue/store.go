@@ -0,0 +1,254 @@
+package bqueue
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/dgraph-io/badger"
+	"github.com/ivanjaros/ijlibs/workers"
+	"time"
+)
+
+const (
+	jobKey   = 'j'
+	readyKey = 'r'
+	deadKey  = 'd'
+	// number of retries of a transaction which conflicted with other transaction
+	conflictRetries = 10
+)
+
+// Creates durable job store backed up by Badger database.
+// Prefix can be optionally added into each key to prevent key collisions in case
+// the badger instance is being used elsewhere.
+// Jobs are indexed by priority and time they become visible so leasing does not have to scan all jobs.
+func New(db *badger.DB, prefix ...byte) (*bStore, error) {
+	if db == nil {
+		return nil, errors.New("no badger connection provided")
+	}
+	return &bStore{db: db, prefix: prefix}, nil
+}
+
+type bStore struct {
+	db     *badger.DB
+	prefix []byte
+}
+
+func (s *bStore) key(kind byte, parts ...[]byte) []byte {
+	key := make([]byte, 0, len(s.prefix)+1+32)
+	key = append(key, s.prefix...)
+	key = append(key, kind)
+	for _, p := range parts {
+		key = append(key, p...)
+	}
+	return key
+}
+
+// higher priority sorts first
+func priorityBytes(priority int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, ^(uint64(int64(priority)) ^ (1 << 63)))
+	return b
+}
+
+func timeBytes(t time.Time) []byte {
+	b := make([]byte, 8)
+	if t.IsZero() == false && t.UnixNano() > 0 {
+		binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	}
+	return b
+}
+
+func visibleAt(job *workers.Job) time.Time {
+	if job.LeaseUntil.After(job.RunAt) {
+		return job.LeaseUntil
+	}
+	return job.RunAt
+}
+
+func (s *bStore) readyKey(job *workers.Job) []byte {
+	return s.key(readyKey, priorityBytes(job.Priority), timeBytes(visibleAt(job)), []byte(job.Id))
+}
+
+// badger transactions conflict when they touch the same keys concurrently, ie. two workers leasing
+// the same job, so the conflicted transaction is retried.
+func (s *bStore) update(fn func(tx *badger.Txn) error) error {
+	var err error
+	for i := 0; i < conflictRetries; i++ {
+		err = s.db.Update(fn)
+		if err != badger.ErrConflict {
+			return err
+		}
+	}
+	return err
+}
+
+func load(tx *badger.Txn, key []byte) (*workers.Job, error) {
+	item, err := tx.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	job := new(workers.Job)
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *bStore) save(tx *badger.Txn, job *workers.Job) error {
+	old, err := load(tx, s.key(jobKey, []byte(job.Id)))
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		if err := tx.Delete(s.readyKey(old)); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if err := tx.Set(s.key(jobKey, []byte(job.Id)), data); err != nil {
+		return err
+	}
+	return tx.Set(s.readyKey(job), nil)
+}
+
+func (s *bStore) Save(job *workers.Job) error {
+	return s.update(func(tx *badger.Txn) error {
+		return s.save(tx, job)
+	})
+}
+
+func (s *bStore) Lease(now, until time.Time) (*workers.Job, error) {
+	var leased *workers.Job
+
+	err := s.update(func(tx *badger.Txn) error {
+		leased = nil
+
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := tx.NewIterator(opts)
+		defer it.Close()
+
+		prefix := s.key(readyKey)
+		nowBytes := timeBytes(now)
+		var id []byte
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); {
+			key := it.Item().Key()[len(prefix):]
+			if len(key) < 16 {
+				it.Next()
+				continue
+			}
+			// keys of each priority are sorted by the time they become visible so if the first one
+			// is not visible yet, neither are the others and we can skip to the next priority.
+			if string(key[8:16]) <= string(nowBytes) {
+				id = append([]byte(nil), key[16:]...)
+				break
+			}
+			next := binary.BigEndian.Uint64(key[:8]) + 1
+			if next == 0 {
+				break
+			}
+			seek := make([]byte, 8)
+			binary.BigEndian.PutUint64(seek, next)
+			it.Seek(s.key(readyKey, seek))
+		}
+
+		if id == nil {
+			return nil
+		}
+
+		job, err := load(tx, s.key(jobKey, id))
+		if err != nil || job == nil {
+			return err
+		}
+		job.Attempts++
+		job.LeaseUntil = until
+		if err := s.save(tx, job); err != nil {
+			return err
+		}
+		leased = job
+		return nil
+	})
+
+	return leased, err
+}
+
+func (s *bStore) Touch(id string, until time.Time) error {
+	return s.update(func(tx *badger.Txn) error {
+		job, err := load(tx, s.key(jobKey, []byte(id)))
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			return workers.ErrJobNotFound
+		}
+		job.LeaseUntil = until
+		return s.save(tx, job)
+	})
+}
+
+func (s *bStore) delete(tx *badger.Txn, id string) error {
+	job, err := load(tx, s.key(jobKey, []byte(id)))
+	if err != nil || job == nil {
+		return err
+	}
+	if err := tx.Delete(s.readyKey(job)); err != nil {
+		return err
+	}
+	return tx.Delete(s.key(jobKey, []byte(id)))
+}
+
+func (s *bStore) Delete(id string) error {
+	return s.update(func(tx *badger.Txn) error {
+		return s.delete(tx, id)
+	})
+}
+
+func (s *bStore) Bury(job *workers.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.update(func(tx *badger.Txn) error {
+		if err := s.delete(tx, job.Id); err != nil {
+			return err
+		}
+		return tx.Set(s.key(deadKey, []byte(job.Id)), data)
+	})
+}
+
+func (s *bStore) Buried() ([]*workers.Job, error) {
+	var jobs []*workers.Job
+
+	err := s.db.View(func(tx *badger.Txn) error {
+		it := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := s.key(deadKey)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			data, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			job := new(workers.Job)
+			if err := json.Unmarshal(data, job); err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+
+	return jobs, err
+}
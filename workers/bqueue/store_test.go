@@ -0,0 +1,173 @@
+package bqueue
+
+import (
+	"github.com/dgraph-io/badger"
+	"github.com/ivanjaros/ijlibs/workers"
+	"testing"
+	"time"
+)
+
+func openStore(t *testing.T, dir string) (*bStore, *badger.DB) {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(db, 'q')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, db
+}
+
+func testStore(t *testing.T) *bStore {
+	t.Helper()
+	s, db := openStore(t, t.TempDir())
+	t.Cleanup(func() { db.Close() })
+	return s
+}
+
+func leaseId(t *testing.T, s *bStore, now, until time.Time) string {
+	t.Helper()
+	job, err := s.Lease(now, until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil {
+		return ""
+	}
+	return job.Id
+}
+
+func TestStorePriority(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+
+	jobs := []*workers.Job{
+		{Id: "low", Priority: 0},
+		{Id: "negative", Priority: -5},
+		{Id: "high", Priority: 10},
+		{Id: "delayed", Priority: 20, RunAt: now.Add(time.Minute)},
+		{Id: "high-later", Priority: 10, RunAt: now.Add(-time.Second)},
+		{Id: "high-earlier", Priority: 10, RunAt: now.Add(-time.Minute)},
+	}
+	for _, job := range jobs {
+		if err := s.Save(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// jobs of the same priority are leased in the order they became visible, the delayed one is skipped
+	until := now.Add(time.Hour)
+	for _, expect := range []string{"high", "high-earlier", "high-later", "low", "negative", ""} {
+		if id := leaseId(t, s, now, until); id != expect {
+			t.Fatalf("expected %q, got %q", expect, id)
+		}
+	}
+
+	if id := leaseId(t, s, now.Add(2*time.Minute), until); id != "delayed" {
+		t.Fatalf("expected delayed job once it is due, got %q", id)
+	}
+}
+
+func TestStoreLease(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+	if err := s.Save(&workers.Job{Id: "job"}); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := s.Lease(now, now.Add(time.Minute))
+	if err != nil || job == nil || job.Id != "job" || job.Attempts != 1 {
+		t.Fatalf("unexpected leased job %+v %v", job, err)
+	}
+
+	// leased job is invisible until the lease expires
+	if id := leaseId(t, s, now.Add(30*time.Second), now.Add(time.Hour)); id != "" {
+		t.Fatalf("leased job %q is visible", id)
+	}
+
+	job, err = s.Lease(now.Add(2*time.Minute), now.Add(3*time.Minute))
+	if err != nil || job == nil || job.Attempts != 2 {
+		t.Fatalf("expired lease has not been released %+v %v", job, err)
+	}
+}
+
+func TestStoreTouch(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+	if err := s.Save(&workers.Job{Id: "job"}); err != nil {
+		t.Fatal(err)
+	}
+	if id := leaseId(t, s, now, now.Add(time.Minute)); id != "job" {
+		t.Fatalf("expected job, got %q", id)
+	}
+
+	if err := s.Touch("job", now.Add(5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if id := leaseId(t, s, now.Add(2*time.Minute), now.Add(time.Hour)); id != "" {
+		t.Fatal("touched job is visible before its extended lease expires")
+	}
+	if id := leaseId(t, s, now.Add(6*time.Minute), now.Add(time.Hour)); id != "job" {
+		t.Fatalf("expected job after the extended lease, got %q", id)
+	}
+
+	if err := s.Touch("missing", now); err != workers.ErrJobNotFound {
+		t.Fatalf("expected job not found, got %v", err)
+	}
+}
+
+func TestStoreBury(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+	if err := s.Save(&workers.Job{Id: "job", LastError: "boom"}); err != nil {
+		t.Fatal(err)
+	}
+	job, err := s.Lease(now, now.Add(time.Minute))
+	if err != nil || job == nil {
+		t.Fatalf("expected leased job, got %v", err)
+	}
+
+	if err := s.Bury(job); err != nil {
+		t.Fatal(err)
+	}
+	if id := leaseId(t, s, now.Add(time.Hour), now.Add(2*time.Hour)); id != "" {
+		t.Fatalf("buried job %q has been leased", id)
+	}
+	dead, err := s.Buried()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].Id != "job" || dead[0].LastError != "boom" {
+		t.Fatalf("unexpected buried jobs %+v", dead)
+	}
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	s, db := openStore(t, dir)
+	if err := s.Save(&workers.Job{Id: "queued", Payload: []byte("data"), Priority: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Bury(&workers.Job{Id: "dead"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, db = openStore(t, dir)
+	defer db.Close()
+
+	job, err := s.Lease(now, now.Add(time.Minute))
+	if err != nil || job == nil || job.Id != "queued" || string(job.Payload) != "data" || job.Priority != 3 {
+		t.Fatalf("queued job has not survived reopening %+v %v", job, err)
+	}
+	dead, err := s.Buried()
+	if err != nil || len(dead) != 1 || dead[0].Id != "dead" {
+		t.Fatalf("buried job has not survived reopening %+v %v", dead, err)
+	}
+}
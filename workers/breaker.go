@@ -0,0 +1,306 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// returned, without calling the function, while the circuit is open
+// or while the half-open circuit is already probing with maximum number of calls.
+var ErrOpenCircuit = errors.New("circuit breaker is open")
+
+type BreakerState int
+
+const (
+	// calls pass through and their failures are counted
+	BreakerClosed BreakerState = iota
+	// calls are rejected until the open timeout passes
+	BreakerOpen
+	// limited number of calls probe whether the dependency has recovered
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type BreakerConfig struct {
+	// opens the circuit after this many failures in a row, zero disables it
+	ConsecutiveFailures int
+	// opens the circuit once this fraction, between 0 and 1, of calls within the window failed, zero disables it
+	FailureRate float64
+	// failure rate is not evaluated until there are at least this many calls within the window
+	MinCalls int
+	// length of the window in which the failure rate is counted, defaults to 1 minute
+	Window time.Duration
+	// how long the circuit stays open before probing, defaults to 30 seconds.
+	// probing calls which have not reported their result within this time are considered lost and new ones are allowed.
+	OpenTimeout time.Duration
+	// number of probing calls allowed in half-open state, all of them must succeed to close the circuit, defaults to 1
+	HalfOpenCalls int
+	// decides whether the error counts as a failure, defaults to any non-nil error
+	IsFailure func(err error) bool
+	// called, outside of the breaker's lock, on each state change. changes are delivered one at a time
+	// and in order, possibly by other goroutine than the one which caused the change.
+	OnStateChange func(name string, from, to BreakerState)
+	// if provided, the breaker pushes its name with true status when closed and false otherwise
+	Monitor Monitor
+	// defaults to the system clock
+	Clock Clock
+}
+
+type CircuitBreaker interface {
+	Name() string
+	State() BreakerState
+	// calls fn unless the circuit is open and records its result. panic of fn is recorded as a failure and re-panicked.
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+	// two-step variant of Do(), the returned function has to be called with the call's result
+	Allow() (done func(err error), err error)
+}
+
+func NewCircuitBreaker(name string, cfg BreakerConfig) *circuitBreaker {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenCalls < 1 {
+		cfg.HalfOpenCalls = 1
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(err error) bool { return err != nil }
+	}
+	cfg.Clock = clockOrSystem(cfg.Clock)
+
+	b := &circuitBreaker{name: name, cfg: cfg, windowStart: cfg.Clock.Now()}
+	if cfg.Monitor != nil {
+		cfg.Monitor.Push(name, true)
+	}
+	return b
+}
+
+type circuitBreaker struct {
+	mx    sync.Mutex
+	name  string
+	cfg   BreakerConfig
+	state BreakerState
+	// incremented on each state change, and when half-open probes expire,
+	// so results of calls started before are ignored
+	generation  uint64
+	openedAt    time.Time
+	windowStart time.Time
+	calls       int
+	failures    int
+	consecutive int
+	// calls allowed in half-open state, how many of them succeeded and when the last one was allowed
+	probes    int
+	successes int
+	probedAt  time.Time
+	// state changes waiting for notification and whether some goroutine is delivering them
+	pending   []stateChange
+	notifying bool
+}
+
+func (b *circuitBreaker) Name() string {
+	return b.name
+}
+
+func (b *circuitBreaker) State() BreakerState {
+	b.mx.Lock()
+	now := b.cfg.Clock.Now()
+	changed := b.advance(now)
+	state := b.state
+	b.mx.Unlock()
+	if changed {
+		b.notify()
+	}
+	return state
+}
+
+func (b *circuitBreaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	generation, err := b.allow()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			b.record(generation, true)
+			panic(r)
+		}
+	}()
+	err = fn(ctx)
+	b.record(generation, b.cfg.IsFailure(err))
+	return err
+}
+
+func (b *circuitBreaker) Allow() (func(err error), error) {
+	generation, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			b.record(generation, b.cfg.IsFailure(err))
+		})
+	}, nil
+}
+
+func (b *circuitBreaker) allow() (uint64, error) {
+	b.mx.Lock()
+	now := b.cfg.Clock.Now()
+	changed := b.advance(now)
+
+	var err error
+	switch b.state {
+	case BreakerOpen:
+		err = ErrOpenCircuit
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenCalls {
+			err = ErrOpenCircuit
+		} else {
+			b.probes++
+			b.probedAt = now
+		}
+	}
+	generation := b.generation
+	b.mx.Unlock()
+	if changed {
+		b.notify()
+	}
+	return generation, err
+}
+
+type stateChange struct {
+	from, to BreakerState
+}
+
+// moves open circuit into half-open state once the timeout passes, expires lost probes of the half-open circuit
+// and resets the closed circuit's window. returns true if the state has changed.
+func (b *circuitBreaker) advance(now time.Time) bool {
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) >= b.cfg.OpenTimeout {
+			return b.setState(BreakerHalfOpen, now)
+		}
+	case BreakerHalfOpen:
+		// probe whose caller panicked or never reported the result would keep the circuit half-open forever
+		if b.probes >= b.cfg.HalfOpenCalls && now.Sub(b.probedAt) >= b.cfg.OpenTimeout {
+			b.generation++
+			b.probes, b.successes = 0, 0
+		}
+	case BreakerClosed:
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.windowStart = now
+			b.calls, b.failures = 0, 0
+		}
+	}
+	return false
+}
+
+func (b *circuitBreaker) record(generation uint64, failed bool) {
+	b.mx.Lock()
+	now := b.cfg.Clock.Now()
+	changed := b.advance(now)
+	if generation != b.generation {
+		b.mx.Unlock()
+		if changed {
+			b.notify()
+		}
+		return
+	}
+
+	switch b.state {
+	case BreakerClosed:
+		b.calls++
+		if failed {
+			b.failures++
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+		if b.tripped() {
+			changed = b.setState(BreakerOpen, now) || changed
+		}
+
+	case BreakerHalfOpen:
+		if failed {
+			changed = b.setState(BreakerOpen, now) || changed
+		} else if b.successes++; b.successes >= b.cfg.HalfOpenCalls {
+			changed = b.setState(BreakerClosed, now) || changed
+		}
+	}
+	b.mx.Unlock()
+	if changed {
+		b.notify()
+	}
+}
+
+func (b *circuitBreaker) tripped() bool {
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+		return true
+	}
+	if b.cfg.FailureRate > 0 && b.calls >= b.cfg.MinCalls && b.calls > 0 {
+		return float64(b.failures)/float64(b.calls) >= b.cfg.FailureRate
+	}
+	return false
+}
+
+// changes the state and queues the notification, returns false if the state is the same
+func (b *circuitBreaker) setState(state BreakerState, now time.Time) bool {
+	if b.state == state {
+		return false
+	}
+	b.pending = append(b.pending, stateChange{from: b.state, to: state})
+	b.state = state
+	b.generation++
+	b.calls, b.failures, b.consecutive = 0, 0, 0
+	b.probes, b.successes = 0, 0
+	b.windowStart = now
+	if state == BreakerOpen {
+		b.openedAt = now
+	}
+	return true
+}
+
+// delivers the queued state changes outside of the lock. only one goroutine delivers them at a time
+// so they cannot overtake each other, the others leave their changes to it.
+func (b *circuitBreaker) notify() {
+	b.mx.Lock()
+	if b.notifying {
+		b.mx.Unlock()
+		return
+	}
+	b.notifying = true
+	for len(b.pending) > 0 {
+		pending := b.pending
+		b.pending = nil
+		b.mx.Unlock()
+
+		for _, change := range pending {
+			if b.cfg.Monitor != nil {
+				b.cfg.Monitor.Push(b.name, change.to == BreakerClosed)
+			}
+			if b.cfg.OnStateChange != nil {
+				b.cfg.OnStateChange(b.name, change.from, change.to)
+			}
+		}
+
+		b.mx.Lock()
+	}
+	b.notifying = false
+	b.mx.Unlock()
+}
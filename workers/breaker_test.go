@@ -0,0 +1,233 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errCall = errors.New("call failed")
+
+func failingCall(ctx context.Context) error    { return errCall }
+func succeedingCall(ctx context.Context) error { return nil }
+
+func TestBreakerConsecutiveFailures(t *testing.T) {
+	clock := newFakeClock()
+	mon := NewMonitor()
+	var changes []string
+	b := NewCircuitBreaker("smtp", BreakerConfig{
+		ConsecutiveFailures: 2,
+		OpenTimeout:         time.Second,
+		Clock:               clock,
+		Monitor:             mon,
+		OnStateChange: func(name string, from, to BreakerState) {
+			changes = append(changes, from.String()+">"+to.String())
+		},
+	})
+	ctx := context.Background()
+
+	b.Do(ctx, failingCall)
+	b.Do(ctx, succeedingCall)
+	b.Do(ctx, failingCall)
+	if b.State() != BreakerClosed || mon.Status() == false {
+		t.Fatal("success must reset consecutive failures")
+	}
+	b.Do(ctx, failingCall)
+	if b.State() != BreakerOpen || mon.Status() {
+		t.Fatal("expected open circuit reflected in the monitor")
+	}
+	if err := b.Do(ctx, succeedingCall); err != ErrOpenCircuit {
+		t.Fatalf("expected open circuit error, got %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if b.State() != BreakerHalfOpen {
+		t.Fatal("expected half-open circuit after the timeout")
+	}
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Allow(); err != ErrOpenCircuit {
+		t.Fatal("only one probe is allowed")
+	}
+	done(nil)
+	if b.State() != BreakerClosed || mon.Status() == false {
+		t.Fatal("expected closed circuit after successful probe")
+	}
+
+	expected := []string{"closed>open", "open>half-open", "half-open>closed"}
+	if len(changes) != len(expected) {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+	for k := range expected {
+		if changes[k] != expected[k] {
+			t.Fatalf("unexpected changes %v", changes)
+		}
+	}
+}
+
+func TestBreakerFailureRate(t *testing.T) {
+	clock := newFakeClock()
+	b := NewCircuitBreaker("epp", BreakerConfig{
+		FailureRate: 0.5,
+		MinCalls:    4,
+		Window:      time.Minute,
+		Clock:       clock,
+	})
+	ctx := context.Background()
+
+	b.Do(ctx, failingCall)
+	b.Do(ctx, failingCall)
+	b.Do(ctx, failingCall)
+	if b.State() != BreakerClosed {
+		t.Fatal("failure rate must not be evaluated below minimum calls")
+	}
+
+	// the window restarts so the old failures are forgotten
+	clock.Advance(time.Minute)
+	b.Do(ctx, failingCall)
+	b.Do(ctx, succeedingCall)
+	b.Do(ctx, succeedingCall)
+	b.Do(ctx, succeedingCall)
+	if b.State() != BreakerClosed {
+		t.Fatal("expected closed circuit below failure rate")
+	}
+	b.Do(ctx, failingCall)
+	b.Do(ctx, failingCall)
+	if b.State() != BreakerOpen {
+		t.Fatal("expected open circuit at failure rate")
+	}
+}
+
+func TestBreakerHalfOpenFailure(t *testing.T) {
+	clock := newFakeClock()
+	b := NewCircuitBreaker("captcha", BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Second, Clock: clock})
+	ctx := context.Background()
+
+	// call started while closed finishes after the circuit opened and must be ignored
+	done, _ := b.Allow()
+	b.Do(ctx, failingCall)
+	done(nil)
+	if b.State() != BreakerOpen {
+		t.Fatal("stale result changed the state")
+	}
+
+	clock.Advance(time.Second)
+	b.Do(ctx, failingCall)
+	if b.State() != BreakerOpen {
+		t.Fatal("failed probe must open the circuit again")
+	}
+}
+
+func TestBreakerNotificationOrder(t *testing.T) {
+	var mx sync.Mutex
+	var changes [][2]BreakerState
+	b := NewCircuitBreaker("smtp", BreakerConfig{
+		ConsecutiveFailures: 1,
+		OpenTimeout:         time.Microsecond,
+		OnStateChange: func(name string, from, to BreakerState) {
+			// slow callback gives other changes a chance to overtake this one
+			time.Sleep(10 * time.Microsecond)
+			mx.Lock()
+			changes = append(changes, [2]BreakerState{from, to})
+			mx.Unlock()
+		},
+	})
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for k := 0; k < 200; k++ {
+				if (i+k)%3 == 0 {
+					b.Do(context.Background(), failingCall)
+				} else {
+					b.Do(context.Background(), succeedingCall)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	mx.Lock()
+	defer mx.Unlock()
+	if len(changes) == 0 {
+		t.Fatal("expected state changes")
+	}
+	prev := BreakerClosed
+	for k, c := range changes {
+		if c[0] != prev {
+			t.Fatalf("change %d from %s arrived after change to %s", k, c[0], prev)
+		}
+		prev = c[1]
+	}
+}
+
+func TestBreakerPanicIsFailure(t *testing.T) {
+	clock := newFakeClock()
+	b := NewCircuitBreaker("smtp", BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Second, Clock: clock})
+	ctx := context.Background()
+
+	panicking := func(ctx context.Context) error { panic("boom") }
+	doPanicking := func() (r interface{}) {
+		defer func() { r = recover() }()
+		b.Do(ctx, panicking)
+		return nil
+	}
+
+	if r := doPanicking(); r != "boom" {
+		t.Fatalf("expected the panic to be propagated, got %v", r)
+	}
+	if b.State() != BreakerOpen {
+		t.Fatal("panic must count as failure")
+	}
+
+	// panicking probe releases its slot and opens the circuit again
+	clock.Advance(time.Second)
+	if r := doPanicking(); r != "boom" {
+		t.Fatalf("expected the panic to be propagated, got %v", r)
+	}
+	if b.State() != BreakerOpen {
+		t.Fatal("panicking probe must open the circuit again")
+	}
+	clock.Advance(time.Second)
+	if err := b.Do(ctx, succeedingCall); err != nil || b.State() != BreakerClosed {
+		t.Fatalf("expected closed circuit after successful probe, got %v %s", err, b.State())
+	}
+}
+
+func TestBreakerLostProbeExpires(t *testing.T) {
+	clock := newFakeClock()
+	b := NewCircuitBreaker("smtp", BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Second, Clock: clock})
+	ctx := context.Background()
+
+	b.Do(ctx, failingCall)
+	clock.Advance(time.Second)
+
+	// the caller never reports the result of the probe
+	lost, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Do(ctx, succeedingCall); err != ErrOpenCircuit {
+		t.Fatalf("expected probing circuit to reject the call, got %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if err := b.Do(ctx, succeedingCall); err != nil {
+		t.Fatalf("expected new probe once the lost one expired, got %v", err)
+	}
+	if b.State() != BreakerClosed {
+		t.Fatal("expected closed circuit after successful probe")
+	}
+
+	// late result of the expired probe is ignored
+	lost(errCall)
+	if b.State() != BreakerClosed {
+		t.Fatal("result of expired probe changed the state")
+	}
+}
@@ -0,0 +1,91 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// returned when the bulkhead has no free slot and its waiting queue is full
+var ErrBulkheadFull = errors.New("bulkhead is full")
+
+// Bulkhead caps number of concurrent calls to a dependency so that a slow dependency
+// cannot take up all workers.
+type Bulkhead interface {
+	Name() string
+	// waits for a free slot, unless too many calls are waiting already, and calls fn
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+	// same as Do() but it fails immediately if there is no free slot
+	TryDo(ctx context.Context, fn func(ctx context.Context) error) error
+	// number of calls in progress
+	Running() int
+	// number of calls waiting for a slot
+	Waiting() int
+}
+
+// maxWaiting limits how many calls can wait for a slot, negative value means no limit
+func NewBulkhead(name string, maxConcurrent, maxWaiting int) *bulkhead {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	return &bulkhead{
+		name:       name,
+		slots:      make(chan struct{}, maxConcurrent),
+		maxWaiting: int64(maxWaiting),
+	}
+}
+
+type bulkhead struct {
+	name       string
+	slots      chan struct{}
+	maxWaiting int64
+	waiting    int64
+}
+
+func (b *bulkhead) Name() string {
+	return b.name
+}
+
+func (b *bulkhead) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	select {
+	case b.slots <- struct{}{}:
+		return b.call(ctx, fn)
+	default:
+	}
+
+	if w := atomic.AddInt64(&b.waiting, 1); b.maxWaiting >= 0 && w > b.maxWaiting {
+		atomic.AddInt64(&b.waiting, -1)
+		return ErrBulkheadFull
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		atomic.AddInt64(&b.waiting, -1)
+		return b.call(ctx, fn)
+	case <-ctx.Done():
+		atomic.AddInt64(&b.waiting, -1)
+		return ctx.Err()
+	}
+}
+
+func (b *bulkhead) TryDo(ctx context.Context, fn func(ctx context.Context) error) error {
+	select {
+	case b.slots <- struct{}{}:
+		return b.call(ctx, fn)
+	default:
+		return ErrBulkheadFull
+	}
+}
+
+func (b *bulkhead) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	defer func() { <-b.slots }()
+	return fn(ctx)
+}
+
+func (b *bulkhead) Running() int {
+	return len(b.slots)
+}
+
+func (b *bulkhead) Waiting() int {
+	return int(atomic.LoadInt64(&b.waiting))
+}
@@ -0,0 +1,61 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBulkhead(t *testing.T) {
+	b := NewBulkhead("gfycat", 1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	go b.Do(context.Background(), func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	if err := b.TryDo(context.Background(), succeedingCall); err != ErrBulkheadFull {
+		t.Fatalf("expected full bulkhead, got %v", err)
+	}
+
+	waited := make(chan error)
+	go func() { waited <- b.Do(context.Background(), succeedingCall) }()
+	for b.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := b.Do(context.Background(), succeedingCall); err != ErrBulkheadFull {
+		t.Fatalf("expected full queue, got %v", err)
+	}
+
+	close(release)
+	if err := <-waited; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBulkheadCancel(t *testing.T) {
+	b := NewBulkhead("epp", 1, -1)
+	release := make(chan struct{})
+	defer close(release)
+	b.TryDo(context.Background(), func(ctx context.Context) error { return nil })
+	go b.Do(context.Background(), func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	for b.Running() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Do(ctx, succeedingCall); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline, got %v", err)
+	}
+	if b.Waiting() != 0 {
+		t.Fatal("cancelled call is still waiting")
+	}
+}
@@ -0,0 +1,55 @@
+package workers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	base := time.Date(2021, 3, 15, 10, 30, 0, 0, time.UTC) // monday
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2021, 3, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, 3, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17 * * mon-fri", time.Date(2021, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2021, 3, 16, 10, 30, 0, 0, time.UTC)},
+		{"0 0 1 jan,jul *", time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, 3, 21, 0, 0, 0, 0, time.UTC)},
+		// either day matches when both are restricted
+		{"0 0 20 * fri", time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2021, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2021, 3, 15, 10, 31, 30, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		s, err := ParseSchedule(test.spec, time.UTC)
+		if err != nil {
+			t.Fatalf("%s: %v", test.spec, err)
+		}
+		if next := s.Next(base); next.Equal(test.next) == false {
+			t.Errorf("%s: expected %s, got %s", test.spec, test.next, next)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * * foo *", "*/0 * * * *", "5-1 * * * *", "@often", "@every -1s"} {
+		if _, err := ParseSchedule(spec, time.UTC); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestScheduleLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	s, err := ParseSchedule("0 8 * * *", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := s.Next(time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC))
+	if next.Equal(time.Date(2021, 3, 15, 6, 0, 0, 0, time.UTC)) == false {
+		t.Fatalf("unexpected time %s", next)
+	}
+}
@@ -0,0 +1,138 @@
+package workers
+
+import (
+	"context"
+	"sync"
+)
+
+// Group runs functions concurrently, at most limit of them at the same time, and collects their errors.
+// the first error cancels the group's context so the other functions can stop early.
+type Group interface {
+	// waits for a free slot and runs fn in a new goroutine.
+	// returns context's error, without running fn, once the group's context is cancelled.
+	Go(fn func(ctx context.Context) error) error
+	// runs fn only if there is a free slot
+	TryGo(fn func(ctx context.Context) error) bool
+	// waits for all functions to finish and returns the first error
+	Wait() error
+	// same as Wait() but it returns context's error once the provided context is cancelled
+	WaitContext(ctx context.Context) error
+	// returns all errors returned so far, in order they were returned
+	Errors() []error
+}
+
+// limit lower than 1 means no limit
+func NewGroup(ctx context.Context, limit int) (*group, context.Context) {
+	g := &group{done: make(chan struct{})}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	if limit > 0 {
+		g.sem = make(chan struct{}, limit)
+	}
+	return g, g.ctx
+}
+
+type group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    chan struct{}
+	mx     sync.Mutex
+	// number of running functions
+	running int
+	// closed and replaced once running drops to zero
+	done chan struct{}
+	errs []error
+}
+
+func (g *group) Go(fn func(ctx context.Context) error) error {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		case <-g.ctx.Done():
+			return g.ctx.Err()
+		}
+	}
+	// the slot may have been released by a failed function
+	if err := g.ctx.Err(); err != nil {
+		g.release()
+		return err
+	}
+	g.run(fn)
+	return nil
+}
+
+func (g *group) TryGo(fn func(ctx context.Context) error) bool {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	if g.ctx.Err() != nil {
+		g.release()
+		return false
+	}
+	g.run(fn)
+	return true
+}
+
+func (g *group) run(fn func(ctx context.Context) error) {
+	g.mx.Lock()
+	g.running++
+	g.mx.Unlock()
+
+	go func() {
+		err := fn(g.ctx)
+
+		g.mx.Lock()
+		if err != nil {
+			g.errs = append(g.errs, err)
+			g.cancel()
+		}
+		g.running--
+		if g.running == 0 {
+			close(g.done)
+			g.done = make(chan struct{})
+		}
+		g.mx.Unlock()
+
+		g.release()
+	}()
+}
+
+func (g *group) release() {
+	if g.sem != nil {
+		<-g.sem
+	}
+}
+
+func (g *group) Wait() error {
+	return g.WaitContext(context.Background())
+}
+
+func (g *group) WaitContext(ctx context.Context) error {
+	g.mx.Lock()
+	running, done := g.running, g.done
+	g.mx.Unlock()
+
+	if running > 0 {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	if len(g.errs) > 0 {
+		return g.errs[0]
+	}
+	return nil
+}
+
+func (g *group) Errors() []error {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	return append([]error(nil), g.errs...)
+}
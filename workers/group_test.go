@@ -0,0 +1,99 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupLimit(t *testing.T) {
+	g, _ := NewGroup(context.Background(), 3)
+
+	var running, max int32
+	for i := 0; i < 20; i++ {
+		err := g.Go(func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if max > 3 {
+		t.Fatalf("limit exceeded, %d functions were running", max)
+	}
+}
+
+func TestGroupFirstErrorCancels(t *testing.T) {
+	g, ctx := NewGroup(context.Background(), 2)
+	boom := errors.New("boom")
+
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	g.Go(func(ctx context.Context) error {
+		return boom
+	})
+
+	// waiting for a slot is released by the cancellation
+	done := make(chan error)
+	go func() {
+		done <- g.Go(func(ctx context.Context) error { return nil })
+	}()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected cancellation, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("go has not been released")
+	}
+
+	if err := g.Wait(); err != boom {
+		t.Fatalf("expected first error, got %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("expected group's context to be cancelled")
+	}
+	if len(g.Errors()) != 2 {
+		t.Fatalf("expected 2 errors, got %v", g.Errors())
+	}
+	if g.TryGo(func(ctx context.Context) error { return nil }) {
+		t.Fatal("cancelled group must not run new functions")
+	}
+}
+
+func TestGroupWaitContext(t *testing.T) {
+	g, _ := NewGroup(context.Background(), 0)
+	release := make(chan struct{})
+	g.Go(func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := g.WaitContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline, got %v", err)
+	}
+
+	close(release)
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
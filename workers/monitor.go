@@ -7,6 +7,8 @@ import "sync"
 type Monitor interface {
 	Push(name string, status bool)
 	Status() bool
+	// returns copy of statuses of all workers
+	Statuses() map[string]bool
 	// listening on the channel is not required, pushing changes will not block
 	Listen() <-chan bool
 	// resets all workers to true and makes the Status() and Listen() active again,
@@ -54,6 +56,16 @@ func (m *monitor) Status() bool {
 	return s
 }
 
+func (m *monitor) Statuses() map[string]bool {
+	m.mx.Lock()
+	s := make(map[string]bool, len(m.s))
+	for k, v := range m.s {
+		s[k] = v
+	}
+	m.mx.Unlock()
+	return s
+}
+
 func (m *monitor) status() bool {
 	if m.stopped {
 		return false
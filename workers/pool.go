@@ -5,15 +5,22 @@ package workers
 
 import (
 	"container/list"
+	"context"
 	"sync"
 )
 
 type Pool interface {
 	Take(n int) bool
+	// same as Take() but it waits until n workers are available or the context is cancelled
+	TakeContext(ctx context.Context, n int) error
 	Return()
 	Available() int
 	Wait(n uint) bool
+	// same as Wait() but it returns context's error once the context is cancelled
+	WaitContext(ctx context.Context, n uint) error
 	Done() bool
+	// same as Done() but it returns context's error once the context is cancelled
+	DoneContext(ctx context.Context) error
 	Max() int
 }
 
@@ -31,7 +38,8 @@ func NewPool(maxAvail int) *workerPool {
 
 type listener struct {
 	above int
-	ch    chan bool
+	// buffered so ping never blocks on a listener which is leaving
+	ch chan bool
 }
 
 func (w *workerPool) Take(n int) bool {
@@ -45,6 +53,26 @@ func (w *workerPool) Take(n int) bool {
 	return ok
 }
 
+func (w *workerPool) TakeContext(ctx context.Context, n int) error {
+	if n > w.max {
+		// this would never succeed so wait only for the cancellation
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if w.Take(n) {
+			return nil
+		}
+		// other caller may take the workers before us so we just try again
+		if err := w.listen(ctx, n-1); err != nil {
+			return err
+		}
+	}
+}
+
 func (w *workerPool) Return() {
 	w.mx.Lock()
 	if w.avail < w.max {
@@ -63,20 +91,28 @@ func (w *workerPool) Available() int {
 
 // this always returns true, but it waits for n+1 available workers before doing so
 func (w *workerPool) Wait(n uint) bool {
-	return w.listen(int(n))
+	return w.listen(context.Background(), int(n)) == nil
+}
+
+func (w *workerPool) WaitContext(ctx context.Context, n uint) error {
+	return w.listen(ctx, int(n))
 }
 
 // same as Wait() but it will return only when all workers are available(all processing is done)
 func (w *workerPool) Done() bool {
-	return w.listen(-1)
+	return w.listen(context.Background(), -1) == nil
 }
 
-func (w *workerPool) listen(n int) bool {
+func (w *workerPool) DoneContext(ctx context.Context) error {
+	return w.listen(ctx, -1)
+}
+
+func (w *workerPool) listen(ctx context.Context, n int) error {
 	w.lMx.Lock()
 
 	worker := &listener{
 		above: n,
-		ch:    make(chan bool),
+		ch:    make(chan bool, 1),
 	}
 	e := w.listeners.PushBack(worker)
 
@@ -84,14 +120,18 @@ func (w *workerPool) listen(n int) bool {
 
 	go w.ping()
 
-	<-worker.ch
+	var err error
+	select {
+	case <-worker.ch:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
 
 	w.lMx.Lock()
-	close(worker.ch)
 	w.listeners.Remove(e)
 	w.lMx.Unlock()
 
-	return true
+	return err
 }
 
 func (w *workerPool) Max() int {
@@ -106,7 +146,10 @@ func (w *workerPool) ping() {
 	for e := w.listeners.Front(); e != nil; e = e.Next() {
 		worker := e.Value.(*listener)
 		if (worker.above == -1 && done) || (worker.above > -1 && worker.above < avail) {
-			worker.ch <- true
+			select {
+			case worker.ch <- true:
+			default:
+			}
 		}
 	}
 
@@ -0,0 +1,82 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPoolWaitContextCancel(t *testing.T) {
+	p := NewPool(2)
+	if p.Take(2) == false {
+		t.Fatal("expected to take all workers")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 3)
+	go func() { errs <- p.WaitContext(ctx, 0) }()
+	go func() { errs <- p.DoneContext(ctx) }()
+	go func() { errs <- p.TakeContext(ctx, 1) }()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-errs:
+			if err != context.Canceled {
+				t.Fatalf("expected cancellation, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("waiter has not been released")
+		}
+	}
+
+	if p.Available() != 0 {
+		t.Fatalf("cancelled take changed available workers to %d", p.Available())
+	}
+	p.Return()
+	p.Return()
+	if p.Done() == false {
+		t.Fatal("expected all workers to be available")
+	}
+}
+
+func TestPoolTakeContext(t *testing.T) {
+	p := NewPool(1)
+	p.Take(1)
+
+	done := make(chan error)
+	go func() { done <- p.TakeContext(context.Background(), 1) }()
+
+	time.Sleep(10 * time.Millisecond)
+	p.Return()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("take has not been released")
+	}
+	if p.Available() != 0 {
+		t.Fatal("expected the worker to be taken")
+	}
+}
+
+func TestSemaphoreTakeContext(t *testing.T) {
+	s := NewSemaphore(1)
+	s.Take(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.TakeContext(ctx, 1); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline, got %v", err)
+	}
+
+	s.Return(1)
+	if s.Try(1) == false {
+		t.Fatal("cancelled take has not released its weight")
+	}
+}
@@ -0,0 +1,334 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ivanjaros/ijlibs/gid"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type Job struct {
+	Id   string
+	Kind string
+	// jobs with higher priority are processed first
+	Priority int
+	Payload  []byte
+	// zero value means the queue's default policy is used
+	Retry RetryPolicy
+	// number of times the job has been leased, including the current run
+	Attempts int
+	// the job will not be leased before this time
+	RunAt time.Time
+	// the job is hidden from other workers until this time, unless it is finished before
+	LeaseUntil time.Time
+	LastError  string
+	Created    time.Time
+}
+
+type RetryPolicy struct {
+	// including the first attempt
+	MaxAttempts int
+	// delay after the first failure, doubled after each next failure
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// fraction, between 0 and 1, of the delay which is randomly subtracted from it
+	Jitter float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Hour,
+	Jitter:      0.2,
+}
+
+// returns delay before the next attempt after the job has failed "attempts" times
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempts-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay -= delay * math.Min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+type JobStore interface {
+	// saves new or updated job
+	Save(job *Job) error
+	// returns the job with the highest priority that is ready to run at provided time and is not leased,
+	// increments its attempts and hides it from other leases until "until".
+	// returns nil job if there is none.
+	Lease(now, until time.Time) (*Job, error)
+	// extends the lease of the running job
+	Touch(id string, until time.Time) error
+	// removes the finished job
+	Delete(id string) error
+	// moves the job into the dead letter
+	Bury(job *Job) error
+	// returns the dead letter jobs
+	Buried() ([]*Job, error)
+}
+
+type JobHandler func(ctx context.Context, job *Job) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// job which fails with permanent error is moved into the dead letter without retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+type QueueConfig struct {
+	// number of jobs processed concurrently, defaults to 1
+	Workers int
+	// job is hidden from other workers for this long and the lease is extended while the job is running,
+	// defaults to 1 minute
+	Visibility time.Duration
+	// how often the store is checked for ready jobs when the queue is idle, defaults to 1 second
+	PollInterval time.Duration
+	// how long running jobs have to finish once the queue is stopped before their context is cancelled,
+	// defaults to 30 seconds
+	DrainTimeout time.Duration
+	// used for jobs without own retry policy, defaults to DefaultRetryPolicy
+	Retry RetryPolicy
+	// called when a job is moved into the dead letter, optional
+	OnDead func(job *Job, err error)
+	// called when the store fails, optional
+	OnError func(err error)
+}
+
+type Queue interface {
+	// job id is generated if it is empty
+	Enqueue(job *Job) error
+	// processes jobs until the context is cancelled, then waits for the running jobs to finish
+	Run(ctx context.Context)
+	// returns the dead letter jobs
+	Dead() ([]*Job, error)
+}
+
+func NewQueue(store JobStore, handler JobHandler, cfg QueueConfig) *jobQueue {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.Visibility <= 0 {
+		cfg.Visibility = time.Minute
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = 30 * time.Second
+	}
+	if cfg.Retry.MaxAttempts < 1 {
+		cfg.Retry = DefaultRetryPolicy
+	}
+	return &jobQueue{
+		store:   store,
+		handler: handler,
+		cfg:     cfg,
+		wake:    make(chan struct{}, cfg.Workers),
+	}
+}
+
+type jobQueue struct {
+	store   JobStore
+	handler JobHandler
+	cfg     QueueConfig
+	wake    chan struct{}
+}
+
+func (q *jobQueue) Enqueue(job *Job) error {
+	if job.Id == "" {
+		job.Id = gid.New()
+	}
+	now := time.Now()
+	if job.Created.IsZero() {
+		job.Created = now
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = now
+	}
+	if err := q.store.Save(job); err != nil {
+		return err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *jobQueue) Dead() ([]*Job, error) {
+	return q.store.Buried()
+}
+
+func (q *jobQueue) Run(ctx context.Context) {
+	// jobs' context is not derived from ctx so the running jobs can finish once the queue is stopped
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < q.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, jobCtx)
+		}()
+	}
+
+	<-ctx.Done()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	t := time.NewTimer(q.cfg.DrainTimeout)
+	defer t.Stop()
+	select {
+	case <-done:
+	case <-t.C:
+		cancelJobs()
+		<-done
+	}
+}
+
+func (q *jobQueue) work(ctx, jobCtx context.Context) {
+	poll := time.NewTicker(q.cfg.PollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		now := time.Now()
+		job, err := q.store.Lease(now, now.Add(q.cfg.Visibility))
+		if err != nil {
+			q.fail(err)
+		}
+		if job != nil {
+			q.process(jobCtx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-poll.C:
+		}
+	}
+}
+
+func (q *jobQueue) process(ctx context.Context, job *Job) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// extends the lease while the job is running
+	go func() {
+		t := time.NewTicker(q.cfg.Visibility / 2)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := q.store.Touch(job.Id, time.Now().Add(q.cfg.Visibility)); err != nil {
+					q.fail(err)
+				}
+			}
+		}
+	}()
+
+	err := q.handle(ctx, job)
+	interrupted := ctx.Err() != nil
+	cancel()
+
+	if err == nil {
+		if err := q.store.Delete(job.Id); err != nil {
+			q.fail(err)
+		}
+		return
+	}
+
+	job.LeaseUntil = time.Time{}
+	job.LastError = err.Error()
+
+	// the job has been interrupted by stopping the queue so it did not actually fail
+	if interrupted && errors.Is(err, context.Canceled) {
+		job.Attempts--
+		if err := q.store.Save(job); err != nil {
+			q.fail(err)
+		}
+		return
+	}
+
+	policy := job.Retry
+	if policy.MaxAttempts < 1 {
+		policy = q.cfg.Retry
+	}
+
+	if IsPermanent(err) || job.Attempts >= policy.MaxAttempts {
+		if err := q.store.Bury(job); err != nil {
+			q.fail(err)
+			return
+		}
+		if q.cfg.OnDead != nil {
+			q.cfg.OnDead(job, err)
+		}
+		return
+	}
+
+	job.RunAt = time.Now().Add(policy.Backoff(job.Attempts))
+	if err := q.store.Save(job); err != nil {
+		q.fail(err)
+	}
+}
+
+// converts handler's panic into an error so the job is retried like with any other failure.
+// handler can still recover on its own and return Permanent error.
+func (q *jobQueue) handle(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return q.handler(ctx, job)
+}
+
+func (q *jobQueue) fail(err error) {
+	if q.cfg.OnError != nil {
+		q.cfg.OnError(err)
+	}
+}
@@ -0,0 +1,103 @@
+package workers
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// in-memory job store, jobs are lost once the process exits.
+func NewMemoryJobStore() *memoryJobStore {
+	return &memoryJobStore{jobs: make(map[string]*Job), dead: make(map[string]*Job)}
+}
+
+type memoryJobStore struct {
+	mx   sync.Mutex
+	jobs map[string]*Job
+	dead map[string]*Job
+}
+
+// jobs are copied so the caller cannot change them outside of the store
+func copyJob(job *Job) *Job {
+	c := *job
+	return &c
+}
+
+func (s *memoryJobStore) Save(job *Job) error {
+	s.mx.Lock()
+	s.jobs[job.Id] = copyJob(job)
+	s.mx.Unlock()
+	return nil
+}
+
+func (s *memoryJobStore) Lease(now, until time.Time) (*Job, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var next *Job
+	for _, job := range s.jobs {
+		if job.RunAt.After(now) || job.LeaseUntil.After(now) {
+			continue
+		}
+		if next == nil || before(job, next) {
+			next = job
+		}
+	}
+
+	if next == nil {
+		return nil, nil
+	}
+
+	next.Attempts++
+	next.LeaseUntil = until
+	return copyJob(next), nil
+}
+
+// higher priority first, then the one that has been waiting longer
+func before(a, b *Job) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if a.RunAt.Equal(b.RunAt) == false {
+		return a.RunAt.Before(b.RunAt)
+	}
+	return a.Id < b.Id
+}
+
+func (s *memoryJobStore) Touch(id string, until time.Time) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	job, ok := s.jobs[id]
+	if ok == false {
+		return ErrJobNotFound
+	}
+	job.LeaseUntil = until
+	return nil
+}
+
+func (s *memoryJobStore) Delete(id string) error {
+	s.mx.Lock()
+	delete(s.jobs, id)
+	s.mx.Unlock()
+	return nil
+}
+
+func (s *memoryJobStore) Bury(job *Job) error {
+	s.mx.Lock()
+	delete(s.jobs, job.Id)
+	s.dead[job.Id] = copyJob(job)
+	s.mx.Unlock()
+	return nil
+}
+
+func (s *memoryJobStore) Buried() ([]*Job, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	out := make([]*Job, 0, len(s.dead))
+	for _, job := range s.dead {
+		out = append(out, copyJob(job))
+	}
+	return out, nil
+}
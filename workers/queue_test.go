@@ -0,0 +1,188 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	cases := []struct {
+		attempts int
+		expect   time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+	for _, c := range cases {
+		if d := p.Backoff(c.attempts); d != c.expect {
+			t.Errorf("attempts %d: expected %s, got %s", c.attempts, c.expect, d)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.Backoff(2); d < time.Second || d > 2*time.Second {
+			t.Fatalf("jittered delay %s out of range", d)
+		}
+	}
+}
+
+// records start time of each attempt and fails the first "failures" attempts with err
+type testHandler struct {
+	mx       sync.Mutex
+	runs     []time.Time
+	failures int
+	err      error
+	panics   bool
+	done     chan struct{}
+}
+
+func newTestHandler(failures int, err error) *testHandler {
+	return &testHandler{failures: failures, err: err, done: make(chan struct{})}
+}
+
+func (h *testHandler) handle(ctx context.Context, job *Job) error {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.runs = append(h.runs, time.Now())
+	if len(h.runs) <= h.failures {
+		if h.panics {
+			panic("boom")
+		}
+		return h.err
+	}
+	close(h.done)
+	return nil
+}
+
+func (h *testHandler) attempts() []time.Time {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return append([]time.Time(nil), h.runs...)
+}
+
+func runQueue(t *testing.T, store JobStore, handler JobHandler, cfg QueueConfig) *jobQueue {
+	t.Helper()
+	cfg.PollInterval = 5 * time.Millisecond
+	q := NewQueue(store, handler, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return q
+}
+
+func TestQueueRetry(t *testing.T) {
+	store := NewMemoryJobStore()
+	h := newTestHandler(2, errors.New("temporary"))
+	q := runQueue(t, store, h.handle, QueueConfig{
+		Retry: RetryPolicy{MaxAttempts: 5, BaseDelay: 20 * time.Millisecond},
+	})
+
+	if err := q.Enqueue(&Job{Kind: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.done:
+	case <-time.After(time.Second):
+		t.Fatal("job has not succeeded")
+	}
+
+	runs := h.attempts()
+	if len(runs) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(runs))
+	}
+	// the delay doubles after each failure
+	for k, expect := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+		if d := runs[k+1].Sub(runs[k]); d < expect {
+			t.Fatalf("attempt %d ran after %s, expected at least %s", k+2, d, expect)
+		}
+	}
+	if dead, _ := q.Dead(); len(dead) != 0 {
+		t.Fatalf("unexpected dead jobs %v", dead)
+	}
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+	fail := errors.New("failed")
+	cases := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"attempts exhausted", fail, 3},
+		{"permanent error", Permanent(fail), 1},
+	}
+
+	for _, c := range cases {
+		store := NewMemoryJobStore()
+		h := newTestHandler(100, c.err)
+		dead := make(chan *Job, 1)
+		q := runQueue(t, store, h.handle, QueueConfig{
+			Retry: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+			OnDead: func(job *Job, err error) {
+				if errors.Is(err, fail) == false {
+					t.Errorf("%s: unexpected error %v", c.name, err)
+				}
+				dead <- job
+			},
+		})
+
+		if err := q.Enqueue(&Job{Id: "job", Kind: "test"}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case job := <-dead:
+			if job.Attempts != c.attempts || job.LastError != fail.Error() {
+				t.Fatalf("%s: unexpected dead job %+v", c.name, job)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: job has not been buried", c.name)
+		}
+
+		buried, err := q.Dead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buried) != 1 || buried[0].Id != "job" {
+			t.Fatalf("%s: unexpected dead letter %v", c.name, buried)
+		}
+		if n := len(h.attempts()); n != c.attempts {
+			t.Fatalf("%s: expected %d attempts, got %d", c.name, c.attempts, n)
+		}
+	}
+}
+
+func TestQueuePanicIsRetried(t *testing.T) {
+	h := newTestHandler(1, nil)
+	h.panics = true
+	q := runQueue(t, NewMemoryJobStore(), h.handle, QueueConfig{
+		Retry: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+	})
+
+	if err := q.Enqueue(&Job{Kind: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.done:
+	case <-time.After(time.Second):
+		t.Fatal("job has not been retried after panic")
+	}
+	if n := len(h.attempts()); n != 2 {
+		t.Fatalf("expected 2 attempts, got %d", n)
+	}
+}
@@ -0,0 +1,291 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// returned when the requested number of tokens exceeds what the limiter can ever allow at once
+var ErrLimitExceeded = errors.New("rate limit exceeded")
+
+type Limiter interface {
+	// same as AllowN(1)
+	Allow() bool
+	// takes n tokens if they are available now
+	AllowN(n int) bool
+	// same as AllowN() but if the tokens are not available it returns how long to wait before trying again,
+	// negative duration means they will never be available.
+	Take(n int) (ok bool, retryAfter time.Duration)
+	// same as WaitN(ctx, 1)
+	Wait(ctx context.Context) error
+	// waits until n tokens are taken or the context is cancelled
+	WaitN(ctx context.Context, n int) error
+}
+
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
+
+// retries take until it succeeds, used by limiters which do not need to reserve tokens in advance
+func waitTake(ctx context.Context, clock Clock, l Limiter, n int) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ok, retry := l.Take(n)
+		if ok {
+			return nil
+		}
+		if retry < 0 {
+			return ErrLimitExceeded
+		}
+		select {
+		case <-clock.After(retry):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Token bucket holds up to burst tokens and is refilled with rate tokens per interval,
+// so it allows bursts of requests while keeping the average rate.
+// nil clock means the system clock is used. panics if per is not positive.
+func NewTokenBucket(rate int, per time.Duration, burst int, clock Clock) *tokenBucket {
+	if per <= 0 {
+		panic("token bucket interval must be positive")
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	clock = clockOrSystem(clock)
+	return &tokenBucket{
+		clock:  clock,
+		rate:   float64(rate) / float64(per),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+type tokenBucket struct {
+	mx     sync.Mutex
+	clock  Clock
+	rate   float64 // tokens per nanosecond
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+float64(elapsed)*b.rate)
+		b.last = now
+	}
+}
+
+func (b *tokenBucket) Take(n int) (bool, time.Duration) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if float64(n) > b.burst || b.rate <= 0 && float64(n) > b.tokens {
+		return false, -1
+	}
+
+	b.refill(b.clock.Now())
+	if b.tokens >= float64(n) {
+		b.tokens -= float64(n)
+		return true, 0
+	}
+	return false, time.Duration(math.Ceil((float64(n) - b.tokens) / b.rate))
+}
+
+func (b *tokenBucket) Allow() bool {
+	return b.AllowN(1)
+}
+
+func (b *tokenBucket) AllowN(n int) bool {
+	ok, _ := b.Take(n)
+	return ok
+}
+
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	return b.WaitN(ctx, 1)
+}
+
+func (b *tokenBucket) WaitN(ctx context.Context, n int) error {
+	return waitTake(ctx, b.clock, b, n)
+}
+
+// Leaky bucket lets requests through at a constant rate of one per interval, without bursts.
+// waiting requests are queued in order they called Wait(), up to capacity of them,
+// others fail immediately with ErrLimitExceeded.
+// nil clock means the system clock is used.
+func NewLeakyBucket(interval time.Duration, capacity int, clock Clock) *leakyBucket {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &leakyBucket{
+		clock:    clockOrSystem(clock),
+		interval: interval,
+		capacity: capacity,
+	}
+}
+
+type leakyBucket struct {
+	mx       sync.Mutex
+	clock    Clock
+	interval time.Duration
+	capacity int
+	// the time when the next request can pass
+	next time.Time
+}
+
+func (b *leakyBucket) Take(n int) (bool, time.Duration) {
+	if n > b.capacity {
+		return false, -1
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	now := b.clock.Now()
+	if b.next.After(now) {
+		return false, b.next.Sub(now)
+	}
+	b.next = now.Add(time.Duration(n) * b.interval)
+	return true, 0
+}
+
+func (b *leakyBucket) Allow() bool {
+	return b.AllowN(1)
+}
+
+func (b *leakyBucket) AllowN(n int) bool {
+	ok, _ := b.Take(n)
+	return ok
+}
+
+func (b *leakyBucket) Wait(ctx context.Context) error {
+	return b.WaitN(ctx, 1)
+}
+
+func (b *leakyBucket) WaitN(ctx context.Context, n int) error {
+	if n > b.capacity {
+		return ErrLimitExceeded
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// reserves the slot at the end of the queue
+	b.mx.Lock()
+	now := b.clock.Now()
+	at := b.next
+	if at.Before(now) {
+		at = now
+	}
+	if at.Sub(now) > time.Duration(b.capacity-n)*b.interval {
+		b.mx.Unlock()
+		return ErrLimitExceeded
+	}
+	end := at.Add(time.Duration(n) * b.interval)
+	b.next = end
+	b.mx.Unlock()
+
+	if at.After(now) == false {
+		return nil
+	}
+
+	select {
+	case <-b.clock.After(at.Sub(now)):
+		return nil
+	case <-ctx.Done():
+		// gives the slot back unless other request has been queued after it
+		b.mx.Lock()
+		if b.next.Equal(end) {
+			b.next = at
+		}
+		b.mx.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Sliding window log allows up to limit requests within any window long period.
+// it remembers time of each request so it is exact but it uses more memory than the buckets.
+// nil clock means the system clock is used.
+func NewSlidingWindow(limit int, window time.Duration, clock Clock) *slidingWindow {
+	if limit < 1 {
+		limit = 1
+	}
+	return &slidingWindow{
+		clock:  clockOrSystem(clock),
+		limit:  limit,
+		window: window,
+		log:    make([]time.Time, limit),
+	}
+}
+
+type slidingWindow struct {
+	mx     sync.Mutex
+	clock  Clock
+	limit  int
+	window time.Duration
+	// ring buffer of times of the requests within the window, oldest first
+	log   []time.Time
+	start int
+	n     int
+}
+
+func (w *slidingWindow) at(i int) time.Time {
+	return w.log[(w.start+i)%w.limit]
+}
+
+func (w *slidingWindow) Take(n int) (bool, time.Duration) {
+	if n > w.limit {
+		return false, -1
+	}
+
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	now := w.clock.Now()
+	from := now.Add(-w.window)
+	for w.n > 0 && w.at(0).After(from) == false {
+		w.start = (w.start + 1) % w.limit
+		w.n--
+	}
+
+	if w.n+n > w.limit {
+		// waits until enough of the oldest requests leave the window
+		return false, w.at(w.n + n - w.limit - 1).Sub(from)
+	}
+
+	for i := 0; i < n; i++ {
+		w.log[(w.start+w.n)%w.limit] = now
+		w.n++
+	}
+	return true, 0
+}
+
+func (w *slidingWindow) Allow() bool {
+	return w.AllowN(1)
+}
+
+func (w *slidingWindow) AllowN(n int) bool {
+	ok, _ := w.Take(n)
+	return ok
+}
+
+func (w *slidingWindow) Wait(ctx context.Context) error {
+	return w.WaitN(ctx, 1)
+}
+
+func (w *slidingWindow) WaitN(ctx context.Context, n int) error {
+	return waitTake(ctx, w.clock, w, n)
+}
@@ -0,0 +1,39 @@
+package workers
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// returns remote host of the request without the port
+func RemoteHostKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// responds with 429 Too Many Requests and Retry-After header, in whole seconds, when the request's key
+// is over the limit. nil key function means all requests share one key.
+func RateLimitHandler(limiter KeyedLimiter, key func(r *http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var k string
+		if key != nil {
+			k = key(r)
+		}
+
+		ok, retry := limiter.Take(k, 1)
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if retry >= 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		}
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	})
+}
@@ -0,0 +1,113 @@
+package workers
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// KeyedLimiter holds separate limiter for each key, ie. user or remote host.
+type KeyedLimiter interface {
+	// returns the key's limiter, creating it if needed
+	Get(key string) Limiter
+	Allow(key string) bool
+	Take(key string, n int) (ok bool, retryAfter time.Duration)
+	Wait(ctx context.Context, key string) error
+	WaitN(ctx context.Context, key string, n int) error
+	// number of keys currently held
+	Len() int
+}
+
+// creates limiters using the factory on demand. once there are more than maxKeys keys, the least recently used
+// ones are evicted, and keys which have not been used for idle duration are evicted too.
+// idle should be long enough for the limiter to fully recover, otherwise the evicted key would get a fresh limit.
+// zero maxKeys or idle disables the respective eviction. nil clock means the system clock is used.
+func NewKeyedLimiter(factory func(key string) Limiter, maxKeys int, idle time.Duration, clock Clock) *keyedLimiter {
+	return &keyedLimiter{
+		factory: factory,
+		maxKeys: maxKeys,
+		idle:    idle,
+		clock:   clockOrSystem(clock),
+		keys:    make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+type keyedLimiter struct {
+	mx      sync.Mutex
+	factory func(key string) Limiter
+	maxKeys int
+	idle    time.Duration
+	clock   Clock
+	keys    map[string]*list.Element
+	// most recently used keys are at the front
+	lru *list.List
+}
+
+type keyedEntry struct {
+	key      string
+	limiter  Limiter
+	lastUsed time.Time
+}
+
+func (k *keyedLimiter) Get(key string) Limiter {
+	k.mx.Lock()
+	defer k.mx.Unlock()
+
+	now := k.clock.Now()
+	k.evict(now)
+
+	if e, ok := k.keys[key]; ok {
+		entry := e.Value.(*keyedEntry)
+		entry.lastUsed = now
+		k.lru.MoveToFront(e)
+		return entry.limiter
+	}
+
+	entry := &keyedEntry{key: key, limiter: k.factory(key), lastUsed: now}
+	k.keys[key] = k.lru.PushFront(entry)
+	if k.maxKeys > 0 && k.lru.Len() > k.maxKeys {
+		k.remove(k.lru.Back())
+	}
+	return entry.limiter
+}
+
+func (k *keyedLimiter) evict(now time.Time) {
+	if k.idle <= 0 {
+		return
+	}
+	for e := k.lru.Back(); e != nil; e = k.lru.Back() {
+		if now.Sub(e.Value.(*keyedEntry).lastUsed) < k.idle {
+			return
+		}
+		k.remove(e)
+	}
+}
+
+func (k *keyedLimiter) remove(e *list.Element) {
+	delete(k.keys, e.Value.(*keyedEntry).key)
+	k.lru.Remove(e)
+}
+
+func (k *keyedLimiter) Allow(key string) bool {
+	return k.Get(key).Allow()
+}
+
+func (k *keyedLimiter) Take(key string, n int) (bool, time.Duration) {
+	return k.Get(key).Take(n)
+}
+
+func (k *keyedLimiter) Wait(ctx context.Context, key string) error {
+	return k.Get(key).Wait(ctx)
+}
+
+func (k *keyedLimiter) WaitN(ctx context.Context, key string, n int) error {
+	return k.Get(key).WaitN(ctx, n)
+}
+
+func (k *keyedLimiter) Len() int {
+	k.mx.Lock()
+	defer k.mx.Unlock()
+	return k.lru.Len()
+}
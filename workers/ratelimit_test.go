@@ -0,0 +1,231 @@
+package workers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mx      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.now = c.now.Add(d)
+	kept := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			kept = append(kept, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = kept
+}
+
+func (c *fakeClock) Waiting() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return len(c.waiters)
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := newFakeClock()
+	b := NewTokenBucket(1, time.Second, 3, clock)
+
+	for i := 0; i < 3; i++ {
+		if b.Allow() == false {
+			t.Fatalf("burst request %d denied", i)
+		}
+	}
+	ok, retry := b.Take(1)
+	if ok || retry != time.Second {
+		t.Fatalf("expected denial with 1s retry, got %v %v", ok, retry)
+	}
+
+	clock.Advance(2 * time.Second)
+	if b.AllowN(2) == false || b.Allow() {
+		t.Fatal("expected exactly two refilled tokens")
+	}
+
+	if ok, retry := b.Take(4); ok || retry >= 0 {
+		t.Fatal("request over burst must never be allowed")
+	}
+}
+
+func TestTokenBucketInvalidInterval(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for zero interval")
+		}
+	}()
+	NewTokenBucket(1, 0, 1, nil)
+}
+
+func TestLeakyBucket(t *testing.T) {
+	clock := newFakeClock()
+	b := NewLeakyBucket(time.Second, 2, clock)
+
+	if b.Allow() == false {
+		t.Fatal("first request denied")
+	}
+	if ok, retry := b.Take(1); ok || retry != time.Second {
+		t.Fatalf("expected denial with 1s retry, got %v %v", ok, retry)
+	}
+
+	// one waiting request fits into the queue, the next one does not
+	done := make(chan error, 1)
+	go func() { done <- b.Wait(context.Background()) }()
+	for clock.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := b.Wait(context.Background()); err != ErrLimitExceeded {
+		t.Fatalf("expected full queue, got %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLeakyBucketCancelReleasesSlot(t *testing.T) {
+	clock := newFakeClock()
+	b := NewLeakyBucket(time.Second, 2, clock)
+	b.Allow()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Wait(ctx) }()
+	for clock.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if b.Allow() == false {
+		t.Fatal("cancelled request kept its slot")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clock := newFakeClock()
+	w := NewSlidingWindow(2, time.Minute, clock)
+
+	w.Allow()
+	clock.Advance(20 * time.Second)
+	w.Allow()
+
+	ok, retry := w.Take(1)
+	if ok || retry != 40*time.Second {
+		t.Fatalf("expected denial with 40s retry, got %v %v", ok, retry)
+	}
+
+	clock.Advance(40 * time.Second)
+	if w.Allow() == false || w.Allow() {
+		t.Fatal("expected exactly one request to leave the window")
+	}
+}
+
+func TestWaitReleasedByClock(t *testing.T) {
+	clock := newFakeClock()
+	b := NewTokenBucket(1, time.Second, 1, clock)
+	b.Allow()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Wait(context.Background()) }()
+	for clock.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyedLimiterEviction(t *testing.T) {
+	clock := newFakeClock()
+	created := 0
+	k := NewKeyedLimiter(func(key string) Limiter {
+		created++
+		return NewTokenBucket(1, time.Hour, 1, clock)
+	}, 2, time.Minute, clock)
+
+	k.Allow("a")
+	k.Allow("b")
+	if k.Allow("a") {
+		t.Fatal("keys must not share the limit")
+	}
+	k.Allow("c")
+	if k.Len() != 2 {
+		t.Fatalf("expected 2 keys, got %d", k.Len())
+	}
+	// "b" was the least recently used one
+	if k.Allow("b") == false {
+		t.Fatal("expected evicted key to get a new limiter")
+	}
+
+	clock.Advance(time.Minute)
+	k.Get("d")
+	if k.Len() != 1 || created != 5 {
+		t.Fatalf("expected idle keys to be evicted, got %d keys and %d limiters", k.Len(), created)
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	clock := newFakeClock()
+	k := NewKeyedLimiter(func(key string) Limiter {
+		return NewTokenBucket(1, 90*time.Second, 1, clock)
+	}, 0, 0, clock)
+	h := RateLimitHandler(k, RemoteHostKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "90" {
+		t.Fatalf("expected 429 with Retry-After 90, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
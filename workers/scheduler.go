@@ -0,0 +1,331 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// what happens with the runs that should have happened while the scheduler was not running
+// or while the previous run was still in progress
+type MissedPolicy int
+
+const (
+	// missed runs are skipped and the task waits for the next scheduled time
+	SkipMissed MissedPolicy = iota
+	// all missed runs are replaced by a single immediate run
+	CatchUpOnce
+	// each missed run is executed, one after another
+	CatchUpAll
+)
+
+// runs of the CatchUpAll policy are limited so a long downtime does not cause endless catching up
+const maxCatchUp = 1000
+
+// run is considered missed once it is late more than this
+const missedAfter = time.Second
+
+type TaskOptions struct {
+	// location in which the cron expression is evaluated, defaults to the scheduler's location
+	Location *time.Location
+	// random delay, between zero and Jitter, added to each run so the tasks of multiple instances do not run at once
+	Jitter time.Duration
+	// by default the next run does not start until the previous one has finished
+	AllowOverlap bool
+	Missed       MissedPolicy
+}
+
+// ScheduleStore persists time of the last run of each task so the missed runs can be detected after restart.
+type ScheduleStore interface {
+	// returns zero time if the task has never run
+	LastRun(name string) (time.Time, error)
+	SetLastRun(name string, at time.Time) error
+}
+
+type SchedulerConfig struct {
+	// defaults to in-memory store
+	Store ScheduleStore
+	// defaults to local time
+	Location *time.Location
+	// how long running tasks have to finish once the scheduler is stopped before their context is cancelled,
+	// defaults to 30 seconds
+	DrainTimeout time.Duration
+	// called when a task or the store fails, optional
+	OnError func(name string, err error)
+	// defaults to the system clock
+	Clock Clock
+}
+
+type Task func(ctx context.Context) error
+
+// Scheduler runs tasks periodically according to cron expressions or intervals.
+// stopping can be bound to the application with app.OnStop(scheduler.Stop).
+type Scheduler interface {
+	// adds the task with spec as accepted by ParseSchedule(), tasks can be added while the scheduler is running
+	Add(name, spec string, task Task, opts TaskOptions) error
+	AddSchedule(name string, schedule Schedule, task Task, opts TaskOptions) error
+	// stops scheduling of the task, its running run is not interrupted
+	Remove(name string)
+	Start()
+	// stops scheduling and waits for the running tasks to finish
+	Stop()
+}
+
+func NewScheduler(cfg SchedulerConfig) *scheduler {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryScheduleStore()
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.Local
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = 30 * time.Second
+	}
+	cfg.Clock = clockOrSystem(cfg.Clock)
+	return &scheduler{cfg: cfg, tasks: make(map[string]*scheduledTask)}
+}
+
+type scheduler struct {
+	mx      sync.Mutex
+	cfg     SchedulerConfig
+	tasks   map[string]*scheduledTask
+	running bool
+	// stops scheduling
+	ctx    context.Context
+	cancel context.CancelFunc
+	// interrupts running tasks once the drain timeout passes
+	taskCtx    context.Context
+	cancelTask context.CancelFunc
+	// scheduling loops and running tasks
+	wg *sync.WaitGroup
+}
+
+type scheduledTask struct {
+	name     string
+	schedule Schedule
+	task     Task
+	opts     TaskOptions
+	cancel   context.CancelFunc
+}
+
+func (s *scheduler) Add(name, spec string, task Task, opts TaskOptions) error {
+	loc := opts.Location
+	if loc == nil {
+		loc = s.cfg.Location
+	}
+	schedule, err := ParseSchedule(spec, loc)
+	if err != nil {
+		return err
+	}
+	return s.AddSchedule(name, schedule, task, opts)
+}
+
+func (s *scheduler) AddSchedule(name string, schedule Schedule, task Task, opts TaskOptions) error {
+	if schedule == nil || task == nil {
+		return errors.New("missing schedule or task")
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if _, ok := s.tasks[name]; ok {
+		return fmt.Errorf("task %q already exists", name)
+	}
+	t := &scheduledTask{name: name, schedule: schedule, task: task, opts: opts}
+	s.tasks[name] = t
+	if s.running {
+		s.start(t)
+	}
+	return nil
+}
+
+func (s *scheduler) Remove(name string) {
+	s.mx.Lock()
+	if t, ok := s.tasks[name]; ok {
+		delete(s.tasks, name)
+		if t.cancel != nil {
+			t.cancel()
+		}
+	}
+	s.mx.Unlock()
+}
+
+func (s *scheduler) Start() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.running {
+		return
+	}
+	s.running = true
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.taskCtx, s.cancelTask = context.WithCancel(context.Background())
+	s.wg = new(sync.WaitGroup)
+	for _, t := range s.tasks {
+		s.start(t)
+	}
+}
+
+func (s *scheduler) start(t *scheduledTask) {
+	var ctx context.Context
+	ctx, t.cancel = context.WithCancel(s.ctx)
+	wg, taskCtx := s.wg, s.taskCtx
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.loop(ctx, taskCtx, wg, t)
+	}()
+}
+
+func (s *scheduler) Stop() {
+	s.mx.Lock()
+	if s.running == false {
+		s.mx.Unlock()
+		return
+	}
+	s.running = false
+	s.cancel()
+	wg, cancelTask := s.wg, s.cancelTask
+	s.mx.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	t := time.NewTimer(s.cfg.DrainTimeout)
+	defer t.Stop()
+	select {
+	case <-done:
+	case <-t.C:
+		cancelTask()
+		<-done
+	}
+	cancelTask()
+}
+
+func (s *scheduler) loop(ctx, taskCtx context.Context, wg *sync.WaitGroup, t *scheduledTask) {
+	clock := s.cfg.Clock
+	now := clock.Now()
+
+	last, err := s.cfg.Store.LastRun(t.name)
+	if err != nil {
+		s.fail(t.name, err)
+	}
+	if last.IsZero() {
+		last = now
+	}
+
+	next := t.schedule.Next(last)
+	caughtUp := 0
+
+	for next.IsZero() == false {
+		if ctx.Err() != nil {
+			return
+		}
+
+		now = clock.Now()
+		if now.Sub(next) <= missedAfter {
+			caughtUp = 0
+			wait := next.Sub(now)
+			if t.opts.Jitter > 0 {
+				wait += time.Duration(rand.Int63n(int64(t.opts.Jitter)))
+			}
+			if wait > 0 {
+				select {
+				case <-clock.After(wait):
+				case <-ctx.Done():
+					return
+				}
+			}
+			s.run(taskCtx, wg, t, next)
+			next = t.schedule.Next(next)
+			continue
+		}
+
+		switch t.opts.Missed {
+		case CatchUpOnce:
+			s.run(taskCtx, wg, t, now)
+			next = t.schedule.Next(now)
+
+		case CatchUpAll:
+			if caughtUp++; caughtUp > maxCatchUp {
+				next = t.schedule.Next(now)
+				continue
+			}
+			s.run(taskCtx, wg, t, next)
+			next = t.schedule.Next(next)
+
+		default:
+			next = t.schedule.Next(now)
+		}
+	}
+}
+
+// runs the task, in the background if overlapping is allowed, and records the run
+func (s *scheduler) run(ctx context.Context, wg *sync.WaitGroup, t *scheduledTask, at time.Time) {
+	exec := func() {
+		if err := s.exec(ctx, t); err != nil {
+			s.fail(t.name, err)
+		}
+		if err := s.cfg.Store.SetLastRun(t.name, at); err != nil {
+			s.fail(t.name, err)
+		}
+	}
+
+	if t.opts.AllowOverlap {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exec()
+		}()
+		return
+	}
+	exec()
+}
+
+// converts task's panic into an error
+func (s *scheduler) exec(ctx context.Context, t *scheduledTask) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return t.task(ctx)
+}
+
+func (s *scheduler) fail(name string, err error) {
+	if s.cfg.OnError != nil {
+		s.cfg.OnError(name, err)
+	}
+}
+
+// in-memory schedule store, the missed runs are not detected after restart
+func NewMemoryScheduleStore() *memoryScheduleStore {
+	return &memoryScheduleStore{runs: make(map[string]time.Time)}
+}
+
+type memoryScheduleStore struct {
+	mx   sync.Mutex
+	runs map[string]time.Time
+}
+
+func (s *memoryScheduleStore) LastRun(name string) (time.Time, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.runs[name], nil
+}
+
+func (s *memoryScheduleStore) SetLastRun(name string, at time.Time) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	// overlapping runs may finish out of order
+	if at.After(s.runs[name]) {
+		s.runs[name] = at
+	}
+	return nil
+}
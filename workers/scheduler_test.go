@@ -0,0 +1,136 @@
+package workers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitForTimer(t *testing.T, clock *fakeClock, n int) {
+	deadline := time.Now().Add(time.Second)
+	for clock.Waiting() < n {
+		if time.Now().After(deadline) {
+			t.Fatal("scheduler is not waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSchedulerRuns(t *testing.T) {
+	clock := newFakeClock()
+	store := NewMemoryScheduleStore()
+	s := NewScheduler(SchedulerConfig{Store: store, Clock: clock})
+
+	var runs int32
+	if err := s.Add("cleanup", "@every 1m", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}, TaskOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("cleanup", "@hourly", func(ctx context.Context) error { return nil }, TaskOptions{}); err == nil {
+		t.Fatal("expected duplicate task error")
+	}
+
+	s.Start()
+	start := clock.Now()
+	for i := 1; i <= 3; i++ {
+		waitForTimer(t, clock, 1)
+		clock.Advance(time.Minute)
+	}
+	waitForTimer(t, clock, 1)
+	s.Stop()
+
+	if atomic.LoadInt32(&runs) != 3 {
+		t.Fatalf("expected 3 runs, got %d", runs)
+	}
+	last, _ := store.LastRun("cleanup")
+	if last.Equal(start.Add(3*time.Minute)) == false {
+		t.Fatalf("unexpected last run %s", last)
+	}
+}
+
+func TestSchedulerMissedRuns(t *testing.T) {
+	tests := []struct {
+		policy MissedPolicy
+		runs   int32
+	}{
+		{SkipMissed, 0},
+		{CatchUpOnce, 1},
+		{CatchUpAll, 10},
+	}
+
+	for _, test := range tests {
+		clock := newFakeClock()
+		store := NewMemoryScheduleStore()
+		store.SetLastRun("rotate", clock.Now().Add(-10*time.Minute))
+
+		s := NewScheduler(SchedulerConfig{Store: store, Clock: clock})
+		var runs int32
+		s.Add("rotate", "@every 1m", func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		}, TaskOptions{Missed: test.policy})
+
+		s.Start()
+		waitForTimer(t, clock, 1)
+		s.Stop()
+
+		if atomic.LoadInt32(&runs) != test.runs {
+			t.Errorf("policy %d: expected %d runs, got %d", test.policy, test.runs, runs)
+		}
+	}
+}
+
+func TestSchedulerStopWaitsForTask(t *testing.T) {
+	clock := newFakeClock()
+	var errs int32
+	s := NewScheduler(SchedulerConfig{
+		Clock:        clock,
+		DrainTimeout: 50 * time.Millisecond,
+		OnError:      func(name string, err error) { atomic.AddInt32(&errs, 1) },
+	})
+
+	started := make(chan struct{})
+	s.Add("approve", "@every 1m", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, TaskOptions{})
+
+	s.Start()
+	waitForTimer(t, clock, 1)
+	clock.Advance(time.Minute)
+	<-started
+
+	// the task is cancelled only after the drain timeout
+	s.Stop()
+	if atomic.LoadInt32(&errs) != 1 {
+		t.Fatal("expected the interrupted task to report its error")
+	}
+}
+
+func TestSchedulerPanic(t *testing.T) {
+	clock := newFakeClock()
+	errs := make(chan error, 1)
+	s := NewScheduler(SchedulerConfig{
+		Clock:   clock,
+		OnError: func(name string, err error) { errs <- err },
+	})
+	s.Add("panic", "@every 1m", func(ctx context.Context) error { panic("boom") }, TaskOptions{})
+
+	s.Start()
+	defer s.Stop()
+	waitForTimer(t, clock, 1)
+	clock.Advance(time.Minute)
+
+	select {
+	case err := <-errs:
+		if err.Error() != "panic: boom" {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic has not been reported")
+	}
+}
@@ -7,6 +7,8 @@ import (
 
 type Semaphore interface {
 	Take(n uint) bool
+	// same as Take() but it returns context's error once the context is cancelled
+	TakeContext(ctx context.Context, n uint) error
 	Try(n uint) bool
 	Return(n uint)
 }
@@ -20,7 +22,11 @@ func NewSemaphore(n uint) Semaphore {
 }
 
 func (s *weighted) Take(n uint) bool {
-	return s.sem.Acquire(context.Background(), int64(n)) == nil
+	return s.TakeContext(context.Background(), n) == nil
+}
+
+func (s *weighted) TakeContext(ctx context.Context, n uint) error {
+	return s.sem.Acquire(ctx, int64(n))
 }
 
 func (s *weighted) Try(n uint) bool {
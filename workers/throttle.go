@@ -2,40 +2,84 @@
 
 package workers
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrThrottleFinished = errors.New("throttle has been finished")
 
 type Throttle interface {
+	// waits for a free slot, returns the first error reported by Done() instead once there is one.
+	// returns ErrThrottleFinished once Finish() has been called.
 	Do() error
-	Done() error
+	// same as Do() but it returns context's error once the context is cancelled
+	DoContext(ctx context.Context) error
+	// releases the slot taken by Do()
+	Done(err error)
+	// waits for all slots to be released and returns the first error reported by Done()
 	Finish() error
+	// same as Finish() but it returns context's error once the context is cancelled
+	FinishContext(ctx context.Context) error
 }
 
 type throttled struct {
-	wg    sync.WaitGroup
-	ch    chan struct{}
-	errCh chan error
+	// guards adding to the wait group so it does not race with waiting for it
+	mx       sync.Mutex
+	finished bool
+	wg       sync.WaitGroup
+	ch       chan struct{}
+	once     sync.Once
+	err      error
+	failed   chan struct{}
 }
 
 func NewThrottle(max int) *throttled {
 	return &throttled{
-		ch:    make(chan struct{}, max),
-		errCh: make(chan error, max),
+		ch:     make(chan struct{}, max),
+		failed: make(chan struct{}),
 	}
 }
 
 func (t *throttled) Do() error {
+	return t.DoContext(context.Background())
+}
+
+func (t *throttled) DoContext(ctx context.Context) error {
+	// the error takes precedence over a free slot
+	select {
+	case <-t.failed:
+		return t.err
+	default:
+	}
+
+	t.mx.Lock()
+	if t.finished {
+		t.mx.Unlock()
+		return ErrThrottleFinished
+	}
+	t.wg.Add(1)
+	t.mx.Unlock()
+
 	select {
 	case t.ch <- struct{}{}:
-		t.wg.Add(1)
 		return nil
-	case err := <-t.errCh:
-		return err
+	case <-t.failed:
+		t.wg.Done()
+		return t.err
+	case <-ctx.Done():
+		t.wg.Done()
+		return ctx.Err()
 	}
 }
 
 func (t *throttled) Done(err error) {
 	if err != nil {
-		t.errCh <- err
+		t.once.Do(func() {
+			t.err = err
+			close(t.failed)
+		})
 	}
 	select {
 	case <-t.ch:
@@ -46,13 +90,30 @@ func (t *throttled) Done(err error) {
 }
 
 func (t *throttled) Finish() error {
-	t.wg.Wait()
-	close(t.ch)
-	close(t.errCh)
-	for err := range t.errCh {
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return t.FinishContext(context.Background())
+}
+
+func (t *throttled) FinishContext(ctx context.Context) error {
+	t.mx.Lock()
+	t.finished = true
+	t.mx.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-t.failed:
+		return t.err
+	default:
+		return nil
+	}
 }
@@ -0,0 +1,104 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	var th Throttle = NewThrottle(2)
+
+	for i := 0; i < 10; i++ {
+		if err := th.Do(); err != nil {
+			t.Fatal(err)
+		}
+		go th.Done(nil)
+	}
+	if err := th.Finish(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestThrottleErrors(t *testing.T) {
+	th := NewThrottle(1)
+	boom := errors.New("boom")
+
+	// more errors than slots must not block
+	for i := 0; i < 3; i++ {
+		if err := th.Do(); err != nil {
+			if err != boom {
+				t.Fatal(err)
+			}
+			break
+		}
+		th.Done(boom)
+	}
+	if err := th.Do(); err != boom {
+		t.Fatalf("expected error, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- th.Finish() }()
+	select {
+	case err := <-done:
+		if err != boom {
+			t.Fatalf("expected error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("finish is blocked")
+	}
+}
+
+func TestThrottleContextCancel(t *testing.T) {
+	th := NewThrottle(1)
+	if err := th.Do(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() { errs <- th.DoContext(ctx) }()
+	// the waiting Do() has to start before Finish() which rejects new ones
+	time.Sleep(10 * time.Millisecond)
+	go func() { errs <- th.FinishContext(ctx) }()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if err != context.Canceled {
+				t.Fatalf("expected cancellation, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("waiter has not been released")
+		}
+	}
+
+	th.Done(nil)
+	if err := th.Finish(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestThrottleDoAfterFinish(t *testing.T) {
+	th := NewThrottle(2)
+	if err := th.Do(); err != nil {
+		t.Fatal(err)
+	}
+
+	finished := make(chan error)
+	go func() { finished <- th.Finish() }()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := th.Do(); err != ErrThrottleFinished {
+		t.Fatalf("expected finished error, got %v", err)
+	}
+	th.Done(nil)
+	if err := <-finished; err != nil {
+		t.Fatal(err)
+	}
+}
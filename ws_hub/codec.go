@@ -0,0 +1,35 @@
+package ws_hub
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+)
+
+// Codec converts websocket frames into messages broadcasted into the channel and vice versa.
+type Codec interface {
+	// returns websocket.TextMessage or websocket.BinaryMessage
+	FrameType() int
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// JSONCodec sends messages as json text frames.
+// inbound frames are validated and broadcasted as json.RawMessage so they are not decoded
+// and encoded again for every recipient.
+type JSONCodec struct{}
+
+func (JSONCodec) FrameType() int {
+	return websocket.TextMessage
+}
+
+func (JSONCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Decode(data []byte) (interface{}, error) {
+	if json.Valid(data) == false {
+		return nil, errors.New("invalid json")
+	}
+	return json.RawMessage(data), nil
+}
@@ -0,0 +1,3 @@
+module github.com/ivanjaros/ijlibs/ws_hub
+
+go 1.17
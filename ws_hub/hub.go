@@ -0,0 +1,187 @@
+package ws_hub
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/ivanjaros/ijlibs/notif"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultMaxMessageSize = 64 << 10
+	DefaultPongWait       = time.Minute
+	DefaultWriteTimeout   = 10 * time.Second
+)
+
+// resolves name of the broker's channel the connection should be subscribed to and subscription options,
+// ie. notif.WriteOnly() for connections which only broadcast into the channel.
+// returned error is sent to the client with 400 status code and the connection is not upgraded.
+type Resolver func(r *http.Request) (name string, opts []notif.SubscribeOption, err error)
+
+func New(broker *notif.Broker, resolver Resolver) *Hub {
+	return &Hub{
+		broker:       broker,
+		resolver:     resolver,
+		codec:        JSONCodec{},
+		maxSize:      DefaultMaxMessageSize,
+		pongWait:     DefaultPongWait,
+		writeTimeout: DefaultWriteTimeout,
+		upgrader:     new(websocket.Upgrader),
+	}
+}
+
+// Hub is http.Handler which maps websocket connection to notif.Client.
+// inbound frames are broadcasted into the channel and messages received from the channel are sent
+// to the connection.
+type Hub struct {
+	broker       *notif.Broker
+	resolver     Resolver
+	codec        Codec
+	maxSize      int64
+	pongWait     time.Duration
+	writeTimeout time.Duration
+	upgrader     *websocket.Upgrader
+}
+
+func (h *Hub) SetCodec(codec Codec) *Hub {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	h.codec = codec
+	return h
+}
+
+// connection is closed if the client sends a frame larger than size
+func (h *Hub) SetMaxMessageSize(size int64) *Hub {
+	h.maxSize = size
+	return h
+}
+
+// connection is closed if the client does not respond to ping within pongWait.
+// pings are sent every 9/10 of pongWait.
+func (h *Hub) SetKeepAlive(pongWait time.Duration) *Hub {
+	h.pongWait = pongWait
+	return h
+}
+
+func (h *Hub) SetWriteTimeout(timeout time.Duration) *Hub {
+	h.writeTimeout = timeout
+	return h
+}
+
+// upgrader can be used to check origin, set buffer sizes or compression
+func (h *Hub) SetUpgrader(upgrader *websocket.Upgrader) *Hub {
+	if upgrader == nil {
+		upgrader = new(websocket.Upgrader)
+	}
+	h.upgrader = upgrader
+	return h
+}
+
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, opts, err := h.resolver(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// upgrader responds with an error on its own
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	client := h.broker.SubscribeWith(name, opts...)
+	defer client.Close()
+
+	readerDone := make(chan struct{})
+	go h.read(conn, client, readerDone)
+
+	h.write(conn, client, readerDone)
+}
+
+// reads inbound frames and broadcasts them into the channel until the connection fails or is closed.
+func (h *Hub) read(conn *websocket.Conn, client *notif.Client, done chan struct{}) {
+	defer close(done)
+
+	if h.maxSize > 0 {
+		conn.SetReadLimit(h.maxSize)
+	}
+	if h.pongWait > 0 {
+		conn.SetReadDeadline(time.Now().Add(h.pongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(h.pongWait))
+		})
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		msg, err := h.codec.Decode(data)
+		if err != nil {
+			h.closeWith(conn, websocket.CloseUnsupportedData, err.Error())
+			return
+		}
+		if client.Broadcast(msg) == false {
+			return
+		}
+	}
+}
+
+// websocket connection supports only one concurrent writer so all writes, including pings, happen here.
+func (h *Hub) write(conn *websocket.Conn, client *notif.Client, readerDone chan struct{}) {
+	var ping <-chan time.Time
+	if h.pongWait > 0 {
+		t := time.NewTicker(h.pongWait * 9 / 10)
+		defer t.Stop()
+		ping = t.C
+	}
+
+	// nil for write-only clients
+	recv := client.Listen()
+
+	for {
+		select {
+		case <-readerDone:
+			return
+
+		case <-client.Done():
+			h.closeWith(conn, websocket.CloseGoingAway, "")
+			return
+
+		case <-ping:
+			if err := conn.WriteControl(websocket.PingMessage, nil, h.deadline()); err != nil {
+				return
+			}
+
+		case v, ok := <-recv:
+			if ok == false {
+				h.closeWith(conn, websocket.CloseGoingAway, "")
+				return
+			}
+			data, err := h.codec.Encode(v)
+			if err != nil {
+				h.closeWith(conn, websocket.CloseInternalServerErr, err.Error())
+				return
+			}
+			conn.SetWriteDeadline(h.deadline())
+			if err := conn.WriteMessage(h.codec.FrameType(), data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *Hub) deadline() time.Time {
+	if h.writeTimeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(h.writeTimeout)
+}
+
+func (h *Hub) closeWith(conn *websocket.Conn, code int, text string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), h.deadline())
+}
@@ -0,0 +1,148 @@
+package ws_hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/ivanjaros/ijlibs/notif"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newServer(t *testing.T) (*notif.Broker, string) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	broker := notif.NewBroker(ctx, time.Second, nil).Configure(func(ch *notif.Channel) {
+		ch.KeepHistory(10, 0)
+	})
+	go broker.Start()
+
+	hub := New(broker, func(r *http.Request) (string, []notif.SubscribeOption, error) {
+		name := r.URL.Query().Get("channel")
+		if name == "" {
+			return "", nil, errors.New("missing channel")
+		}
+		if since := r.URL.Query().Get("since"); since != "" {
+			seq, err := strconv.ParseUint(since, 10, 64)
+			if err != nil {
+				return "", nil, err
+			}
+			return name, []notif.SubscribeOption{notif.Since(seq)}, nil
+		}
+		return name, nil, nil
+	})
+
+	srv := httptest.NewServer(hub)
+	t.Cleanup(srv.Close)
+	return broker, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	return conn
+}
+
+// the connection is subscribed after the upgrade so the dial can return before that
+func waitForMembers(t *testing.T, broker *notif.Broker, name string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for len(broker.Members(name)) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d members", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	broker, url := newServer(t)
+	sender := dial(t, url+"?channel=chat")
+	receiver := dial(t, url+"?channel=chat")
+	waitForMembers(t, broker, "chat", 2)
+
+	if err := sender.WriteMessage(websocket.TextMessage, []byte(`{"text":"hello"}`)); err != nil {
+		t.Fatal(err)
+	}
+	typ, data, err := receiver.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != websocket.TextMessage || string(data) != `{"text":"hello"}` {
+		t.Fatalf("unexpected frame %d %s", typ, data)
+	}
+
+	// the sender does not receive its own message, only the following one
+	broker.Broadcast("chat") <- "server"
+	if _, data, err := sender.ReadMessage(); err != nil || string(data) != `"server"` {
+		t.Fatalf("unexpected frame %s: %v", data, err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	broker, url := newServer(t)
+	for _, v := range []string{"a", "b", "c"} {
+		broker.Broadcast("test") <- v
+	}
+
+	conn := dial(t, url+"?channel=test&since=1")
+	for _, expect := range []string{"b", "c"} {
+		var msg notif.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Payload != expect || msg.Channel != "test" {
+			t.Fatalf("expected %s, got %+v", expect, msg)
+		}
+	}
+}
+
+func TestInvalidFrame(t *testing.T) {
+	_, url := newServer(t)
+	conn := dial(t, url+"?channel=test")
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := conn.ReadMessage()
+	if websocket.IsCloseError(err, websocket.CloseUnsupportedData) == false {
+		t.Fatalf("expected unsupported data close, got %v", err)
+	}
+}
+
+func TestResolverError(t *testing.T) {
+	_, url := newServer(t)
+	_, res, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || res == nil || res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected bad request, got %v", err)
+	}
+}
+
+func TestJSONCodec(t *testing.T) {
+	var c JSONCodec
+	v, err := c.Decode([]byte(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(json.RawMessage); ok == false {
+		t.Fatalf("expected raw message, got %T", v)
+	}
+	data, err := c.Encode(v)
+	if err != nil || string(data) != `{"a":1}` {
+		t.Fatalf("unexpected encoding %s: %v", data, err)
+	}
+	if _, err := c.Decode([]byte("nope")); err == nil {
+		t.Fatal("expected invalid json error")
+	}
+}